@@ -3,26 +3,33 @@ package steam
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"math/rand"
+	"net"
+	"sort"
+	"strconv"
 )
 
 const (
-	hInfoRequest                  = 'T'
-	hInfoResponse                 = 'I'
-	hPlayersInfoRequest           = 'U'
-	hPlayersInfoChallengeResponse = 'A'
-	hPlayersInfoResponse          = 'D'
+	hInfoRequest          = 'T'
+	hInfoResponse         = 'I'
+	hInfoObsoleteResponse = 'm'
+	hPlayersInfoRequest   = 'U'
+	hPlayersInfoResponse  = 'D'
+	hRulesRequest         = 'V'
+	hRulesResponse        = 'E'
+	hChallengeResponse    = 'A'
 )
 
 type ServerType int
 
 func (st *ServerType) unmarshalBinary(data []byte) error {
 	switch data[0] {
-	case 'd':
+	case 'd', 'D':
 		*st = STDedicated
-	case 'l':
+	case 'l', 'L':
 		*st = STNonDedicated
-	case 'p':
+	case 'p', 'P':
 		*st = STProxy
 	default:
 		return errBadData
@@ -30,6 +37,18 @@ func (st *ServerType) unmarshalBinary(data []byte) error {
 	return nil
 }
 
+func (st ServerType) marshalBinary() ([]byte, error) {
+	switch st {
+	case STDedicated:
+		return []byte{'d'}, nil
+	case STNonDedicated:
+		return []byte{'l'}, nil
+	case STProxy:
+		return []byte{'p'}, nil
+	}
+	return nil, errBadData
+}
+
 func (st ServerType) String() string {
 	return serverTypeStrings[st]
 }
@@ -52,10 +71,10 @@ type Environment int
 
 func (e *Environment) unmarshalBinary(data []byte) error {
 	switch data[0] {
-	case 'l':
+	case 'l', 'L':
 		*e = ELinux
 		return nil
-	case 'w':
+	case 'w', 'W':
 		*e = EWindows
 		return nil
 	case 'm', 'o':
@@ -66,6 +85,18 @@ func (e *Environment) unmarshalBinary(data []byte) error {
 	}
 }
 
+func (e Environment) marshalBinary() ([]byte, error) {
+	switch e {
+	case ELinux:
+		return []byte{'l'}, nil
+	case EWindows:
+		return []byte{'w'}, nil
+	case EMac:
+		return []byte{'m'}, nil
+	}
+	return nil, errBadData
+}
+
 func (e Environment) String() string {
 	return environmentStrings[e]
 }
@@ -99,6 +130,16 @@ func (v *Visibility) unmarshalBinary(data []byte) error {
 	}
 }
 
+func (v Visibility) marshalBinary() ([]byte, error) {
+	switch v {
+	case VPublic:
+		return []byte{0}, nil
+	case VPrivate:
+		return []byte{1}, nil
+	}
+	return nil, errBadData
+}
+
 func (v Visibility) String() string {
 	return visibilityStrings[v]
 }
@@ -130,6 +171,16 @@ func (v *VAC) unmarshalBinary(data []byte) error {
 	}
 }
 
+func (v VAC) marshalBinary() ([]byte, error) {
+	switch v {
+	case VACUnsecured:
+		return []byte{0}, nil
+	case VACSecure:
+		return []byte{1}, nil
+	}
+	return nil, errBadData
+}
+
 func (v VAC) String() string {
 	return vacStrings[v]
 }
@@ -147,16 +198,42 @@ var vacStrings = map[VAC]string{
 }
 
 type infoRequest struct {
+	// Challenge handed out by servers that require one. Left out of the
+	// request if zero.
+	Challenge int
 }
 
-func (infoRequest) marshalBinary() ([]byte, error) {
+func (r infoRequest) marshalBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	writeRequestPrefix(buf)
 	writeByte(buf, hInfoRequest)
 	writeString(buf, "Source Engine Query")
+	if r.Challenge != 0 {
+		writeLong(buf, int32(r.Challenge))
+	}
 	return buf.Bytes(), nil
 }
 
+func (r *infoRequest) unmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	header := readByte(buf)
+	if header != hInfoRequest {
+		panic(errBadData)
+	}
+	if readString(buf) != "Source Engine Query" {
+		panic(errBadData)
+	}
+	if buf.Len() >= 4 {
+		r.Challenge = toInt(readLong(buf))
+	}
+	return nil
+}
+
 type InfoResponse struct {
 	Protocol    int
 	Name        string
@@ -173,6 +250,7 @@ type InfoResponse struct {
 	VAC         VAC
 	Version     string
 
+	// Game port, which may differ from the query port.
 	Port    int
 	SteamID int64
 
@@ -181,6 +259,108 @@ type InfoResponse struct {
 
 	Keywords string
 	GameID   int64
+
+	// Only set by servers running The Ship.
+	Ship *ShipInfo
+
+	// Only set by GoldSrc servers answering in the obsolete format.
+	Address string
+	Mod     *ModInfo
+
+	// Address the response came from. Not sent by QueryServer.
+	RemoteAddr net.Addr
+}
+
+// JoinAddr returns the address players connect to: the host the response
+// came from, with the game port if the server sent one. It is empty if
+// RemoteAddr is not set.
+func (r *InfoResponse) JoinAddr() string {
+	if r.RemoteAddr == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(r.RemoteAddr.String())
+	if err != nil {
+		return ""
+	}
+	if r.Port != 0 {
+		port = strconv.Itoa(r.Port)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// App ID of The Ship, which extends the info and players responses.
+const appIDTheShip = 2400
+
+type ShipMode int
+
+func (m *ShipMode) unmarshalBinary(data []byte) error {
+	switch data[0] {
+	case 0:
+		*m = SMHunt
+	case 1:
+		*m = SMElimination
+	case 2:
+		*m = SMDuel
+	case 3:
+		*m = SMDeathmatch
+	case 4:
+		*m = SMVIPTeam
+	case 5:
+		*m = SMTeamElimination
+	default:
+		return errBadData
+	}
+	return nil
+}
+
+func (m ShipMode) marshalBinary() ([]byte, error) {
+	if m <= SMInvalid || m > SMTeamElimination {
+		return nil, errBadData
+	}
+	return []byte{byte(m - SMHunt)}, nil
+}
+
+func (m ShipMode) String() string {
+	return shipModeStrings[m]
+}
+
+const (
+	SMInvalid ShipMode = iota
+	SMHunt
+	SMElimination
+	SMDuel
+	SMDeathmatch
+	SMVIPTeam
+	SMTeamElimination
+)
+
+var shipModeStrings = map[ShipMode]string{
+	SMInvalid:         "Invalid",
+	SMHunt:            "Hunt",
+	SMElimination:     "Elimination",
+	SMDuel:            "Duel",
+	SMDeathmatch:      "Deathmatch",
+	SMVIPTeam:         "VIP Team",
+	SMTeamElimination: "Team Elimination",
+}
+
+// ShipInfo holds the game settings of a server running The Ship.
+type ShipInfo struct {
+	Mode      ShipMode
+	Witnesses int
+	// Time in seconds before a player is arrested while being witnessed.
+	Duration int
+}
+
+// ModInfo describes the Half-Life mod run by a GoldSrc server.
+type ModInfo struct {
+	Link         string
+	DownloadLink string
+	Version      int
+	Size         int
+
+	MultiplayerOnly bool
+	OwnDLL          bool
 }
 
 const (
@@ -199,6 +379,10 @@ func (r *InfoResponse) unmarshalBinary(data []byte) (err error) {
 	}()
 	buf := bytes.NewBuffer(data)
 	header := readByte(buf)
+	if header == hInfoObsoleteResponse {
+		r.unmarshalObsolete(buf)
+		return nil
+	}
 	if header != hInfoResponse {
 		panic(errBadData)
 	}
@@ -207,7 +391,7 @@ func (r *InfoResponse) unmarshalBinary(data []byte) (err error) {
 	r.Map = readString(buf)
 	r.Folder = readString(buf)
 	r.Game = readString(buf)
-	r.ID = toInt(readShort(buf))
+	r.ID = toInt(readUShort(buf))
 	r.Players = toInt(readByte(buf))
 	r.MaxPlayers = toInt(readByte(buf))
 	r.Bots = toInt(readByte(buf))
@@ -215,6 +399,13 @@ func (r *InfoResponse) unmarshalBinary(data []byte) (err error) {
 	must(r.Environment.unmarshalBinary(readBytes(buf, 1)))
 	must(r.Visibility.unmarshalBinary(readBytes(buf, 1)))
 	must(r.VAC.unmarshalBinary(readBytes(buf, 1)))
+	if r.ID == appIDTheShip {
+		var ship ShipInfo
+		must(ship.Mode.unmarshalBinary(readBytes(buf, 1)))
+		ship.Witnesses = toInt(readByte(buf))
+		ship.Duration = toInt(readByte(buf))
+		r.Ship = &ship
+	}
 	r.Version = readString(buf)
 	// Check if EDF byte is present
 	if buf.Len() < 1 {
@@ -223,13 +414,13 @@ func (r *InfoResponse) unmarshalBinary(data []byte) (err error) {
 	// EDF byte present
 	edf := readByte(buf)
 	if edf&edfPort != 0 {
-		r.Port = toInt(readShort(buf))
+		r.Port = toInt(readUShort(buf))
 	}
 	if edf&edfSteamID != 0 {
 		r.SteamID = readLongLong(buf)
 	}
 	if edf&edfSourceTV != 0 {
-		r.SourceTVPort = toInt(readShort(buf))
+		r.SourceTVPort = toInt(readUShort(buf))
 		r.SourceTVName = readString(buf)
 	}
 	if edf&edfKeywords != 0 {
@@ -242,6 +433,113 @@ func (r *InfoResponse) unmarshalBinary(data []byte) (err error) {
 	return nil
 }
 
+type binaryMarshaler interface {
+	marshalBinary() ([]byte, error)
+}
+
+func writeMarshalers(buf *bytes.Buffer, ms ...binaryMarshaler) error {
+	for _, m := range ms {
+		data, err := m.marshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return nil
+}
+
+func (r *InfoResponse) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	writeByte(buf, hInfoResponse)
+	writeByte(buf, byte(r.Protocol))
+	writeString(buf, r.Name)
+	writeString(buf, r.Map)
+	writeString(buf, r.Folder)
+	writeString(buf, r.Game)
+	writeUShort(buf, uint16(r.ID))
+	writeByte(buf, byte(r.Players))
+	writeByte(buf, byte(r.MaxPlayers))
+	writeByte(buf, byte(r.Bots))
+	if err := writeMarshalers(buf, r.ServerType, r.Environment, r.Visibility, r.VAC); err != nil {
+		return nil, err
+	}
+	if r.Ship != nil {
+		if err := writeMarshalers(buf, r.Ship.Mode); err != nil {
+			return nil, err
+		}
+		writeByte(buf, byte(r.Ship.Witnesses))
+		writeByte(buf, byte(r.Ship.Duration))
+	}
+	writeString(buf, r.Version)
+	var edf byte
+	if r.Port != 0 {
+		edf |= edfPort
+	}
+	if r.SteamID != 0 {
+		edf |= edfSteamID
+	}
+	if r.SourceTVPort != 0 {
+		edf |= edfSourceTV
+	}
+	if r.Keywords != "" {
+		edf |= edfKeywords
+	}
+	if r.GameID != 0 {
+		edf |= edfGameID
+	}
+	if edf == 0 {
+		return buf.Bytes(), nil
+	}
+	writeByte(buf, edf)
+	if edf&edfPort != 0 {
+		writeUShort(buf, uint16(r.Port))
+	}
+	if edf&edfSteamID != 0 {
+		writeLongLong(buf, r.SteamID)
+	}
+	if edf&edfSourceTV != 0 {
+		writeUShort(buf, uint16(r.SourceTVPort))
+		writeString(buf, r.SourceTVName)
+	}
+	if edf&edfKeywords != 0 {
+		writeString(buf, r.Keywords)
+	}
+	if edf&edfGameID != 0 {
+		writeLongLong(buf, r.GameID)
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalObsolete decodes the response sent by old GoldSrc servers and
+// HLTV proxies.
+func (r *InfoResponse) unmarshalObsolete(buf *bytes.Buffer) {
+	r.Address = readString(buf)
+	r.Name = readString(buf)
+	r.Map = readString(buf)
+	r.Folder = readString(buf)
+	r.Game = readString(buf)
+	r.Players = toInt(readByte(buf))
+	r.MaxPlayers = toInt(readByte(buf))
+	r.Protocol = toInt(readByte(buf))
+	must(r.ServerType.unmarshalBinary(readBytes(buf, 1)))
+	must(r.Environment.unmarshalBinary(readBytes(buf, 1)))
+	must(r.Visibility.unmarshalBinary(readBytes(buf, 1)))
+	if readByte(buf) == 1 {
+		var m ModInfo
+		m.Link = readString(buf)
+		m.DownloadLink = readString(buf)
+		readByte(buf)
+		m.Version = toInt(readLong(buf))
+		m.Size = toInt(readLong(buf))
+		m.MultiplayerOnly = readByte(buf) == 1
+		m.OwnDLL = readByte(buf) == 1
+		r.Mod = &m
+	}
+	must(r.VAC.unmarshalBinary(readBytes(buf, 1)))
+	r.Bots = toInt(readByte(buf))
+}
+
 func (r *InfoResponse) String() string {
 	return fmt.Sprintf("%v %v %v/%v (%v bots) %v", r.Name, r.Map, r.Players, r.MaxPlayers, r.Bots, r.VAC)
 }
@@ -258,15 +556,42 @@ func (r playersInfoRequest) marshalBinary() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func isPlayersInfoChallengeResponse(b []byte) bool {
-	return b[0] == hPlayersInfoChallengeResponse
+func (r *playersInfoRequest) unmarshalBinary(data []byte) error {
+	return unmarshalChallengeRequest(data, hPlayersInfoRequest, &r.Challenge)
 }
 
-type playersInfoChallengeResponse struct {
+func unmarshalChallengeRequest(data []byte, h byte, challenge *int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	header := readByte(buf)
+	if header != h {
+		panic(errBadData)
+	}
+	*challenge = toInt(readLong(buf))
+	return nil
+}
+
+func isChallengeResponse(b []byte) bool {
+	return b[0] == hChallengeResponse
+}
+
+type challengeResponse struct {
 	Challenge int
 }
 
-func (r *playersInfoChallengeResponse) unmarshalBinary(data []byte) (err error) {
+func (r challengeResponse) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	writeByte(buf, hChallengeResponse)
+	writeLong(buf, int32(r.Challenge))
+	return buf.Bytes(), nil
+}
+
+func (r *challengeResponse) unmarshalBinary(data []byte) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = r.(error)
@@ -274,7 +599,7 @@ func (r *playersInfoChallengeResponse) unmarshalBinary(data []byte) (err error)
 	}()
 	buf := bytes.NewBuffer(data)
 	header := readByte(buf)
-	if header != hPlayersInfoChallengeResponse {
+	if header != hChallengeResponse {
 		panic(errBadData)
 	}
 	r.Challenge = toInt(readLong(buf))
@@ -283,9 +608,46 @@ func (r *playersInfoChallengeResponse) unmarshalBinary(data []byte) (err error)
 
 type PlayersInfoResponse struct {
 	Players []*Player
+
+	// Address the response came from. Not sent by QueryServer.
+	RemoteAddr net.Addr
 }
 
-func (r *PlayersInfoResponse) unmarshalBinary(data []byte) (err error) {
+// marshalBinary encodes the response. The extra fields of The Ship are
+// written if the players carry them.
+func (r *PlayersInfoResponse) marshalBinary() ([]byte, error) {
+	if len(r.Players) > 255 {
+		return nil, errBadData
+	}
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	writeByte(buf, hPlayersInfoResponse)
+	writeByte(buf, byte(len(r.Players)))
+	for i, p := range r.Players {
+		writeByte(buf, byte(i))
+		writeString(buf, p.Name)
+		writeLong(buf, int32(p.Score))
+		writeFloat(buf, float32(p.Duration))
+	}
+	if len(r.Players) == 0 || r.Players[0].Ship == nil {
+		return buf.Bytes(), nil
+	}
+	for _, p := range r.Players {
+		var ship PlayerShipInfo
+		if p.Ship != nil {
+			ship = *p.Ship
+		}
+		writeLong(buf, int32(ship.Deaths))
+		writeLong(buf, int32(ship.Money))
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalBinary decodes the response of a server running the game with
+// the given app ID. The extra fields of The Ship are decoded if the app ID
+// is the one of The Ship, or if exactly the size of them is left after the
+// players, so they are found even if the app ID is unknown.
+func (r *PlayersInfoResponse) unmarshalBinary(data []byte, appID int) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = r.(error)
@@ -306,6 +668,16 @@ func (r *PlayersInfoResponse) unmarshalBinary(data []byte) (err error) {
 		p.Duration = float64(readFloat(buf))
 		r.Players = append(r.Players, &p)
 	}
+	if count == 0 || appID != appIDTheShip && buf.Len() != 8*count {
+		return nil
+	}
+	// The Ship appends the deaths and money of every player.
+	for _, p := range r.Players {
+		p.Ship = &PlayerShipInfo{
+			Deaths: toInt(readLong(buf)),
+			Money:  toInt(readLong(buf)),
+		}
+	}
 	return nil
 }
 
@@ -313,6 +685,81 @@ type Player struct {
 	Name     string
 	Score    int
 	Duration float64
+
+	// Only set for servers running The Ship.
+	Ship *PlayerShipInfo
+}
+
+// PlayerShipInfo holds the extra player stats of The Ship.
+type PlayerShipInfo struct {
+	Deaths int
+	Money  int
+}
+
+type rulesRequest struct {
+	Challenge int
+}
+
+func (r rulesRequest) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	writeByte(buf, hRulesRequest)
+	writeLong(buf, int32(r.Challenge))
+	return buf.Bytes(), nil
+}
+
+func (r *rulesRequest) unmarshalBinary(data []byte) error {
+	return unmarshalChallengeRequest(data, hRulesRequest, &r.Challenge)
+}
+
+// RulesResponse holds the public cvars of a server.
+type RulesResponse struct {
+	Rules map[string]string
+
+	// Address the response came from. Not sent by QueryServer.
+	RemoteAddr net.Addr
+}
+
+func (r *RulesResponse) marshalBinary() ([]byte, error) {
+	if len(r.Rules) > math.MaxUint16 {
+		return nil, errBadData
+	}
+	names := make([]string, 0, len(r.Rules))
+	for name := range r.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	writeByte(buf, hRulesResponse)
+	writeUShort(buf, uint16(len(names)))
+	for _, name := range names {
+		writeString(buf, name)
+		writeString(buf, r.Rules[name])
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *RulesResponse) unmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	header := readByte(buf)
+	if header != hRulesResponse {
+		panic(errBadData)
+	}
+	count := toInt(readUShort(buf))
+	r.Rules = make(map[string]string, count)
+	// Some servers announce more rules than they send, so stop at the end
+	// of the data.
+	for i := 0; i < count && buf.Len() > 0; i++ {
+		name := readString(buf)
+		r.Rules[name] = readString(buf)
+	}
+	return nil
 }
 
 type rconRequestType int32
@@ -355,6 +802,20 @@ func (r *rconRequest) marshalBinary() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+func (r *rconRequest) unmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	r.size = readLong(buf)
+	r.id = readLong(buf)
+	r.typ = rconRequestType(readLong(buf))
+	r.body = string(readBytes(buf, int(r.size-10)))
+	return nil
+}
+
 type rconResponse struct {
 	size int32
 	id   int32
@@ -366,6 +827,26 @@ func (r *rconResponse) String() string {
 	return fmt.Sprintf("%v %v %v %v", r.size, r.id, r.typ, string(r.body))
 }
 
+func newRCONResponse(id int32, typ rconRequestType, body []byte) *rconResponse {
+	return &rconResponse{
+		size: int32(len(body) + 10),
+		id:   id,
+		typ:  typ,
+		body: body,
+	}
+}
+
+func (r *rconResponse) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeLong(buf, r.size)
+	writeLong(buf, r.id)
+	writeLong(buf, int32(r.typ))
+	buf.Write(r.body)
+	writeNull(buf)
+	writeNull(buf)
+	return buf.Bytes(), nil
+}
+
 func (r *rconResponse) unmarshalBinary(data []byte) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
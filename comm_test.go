@@ -0,0 +1,173 @@
+package steam
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// shipPlayersResponse is an A2S_PLAYER response of a server running The
+// Ship, laid out as documented by Valve: the usual player records, then
+// the deaths and money of every player.
+var shipPlayersResponse = []byte{
+	'D', 2,
+	0, 'B', 'o', 'b', 0, 3, 0, 0, 0, 0x00, 0x00, 0x20, 0x41, // Bob, 3, 10s
+	1, '[', 'x', ']', ' ', '"', 'q', '"', 0, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xA0, 0x40, // [x] "q", -1, 5s
+	1, 0, 0, 0, 0x88, 0x13, 0, 0, // 1 death, 5000 money
+	4, 0, 0, 0, 0xF4, 0x01, 0, 0, // 4 deaths, 500 money
+}
+
+func TestPlayersInfoResponseShip(t *testing.T) {
+	want := []*Player{
+		{Name: "Bob", Score: 3, Duration: 10, Ship: &PlayerShipInfo{Deaths: 1, Money: 5000}},
+		{Name: `[x] "q"`, Score: -1, Duration: 5, Ship: &PlayerShipInfo{Deaths: 4, Money: 500}},
+	}
+	for _, appID := range []int{appIDTheShip, 0} {
+		var r PlayersInfoResponse
+		if err := r.unmarshalBinary(shipPlayersResponse, appID); err != nil {
+			t.Fatalf("app %v: %v", appID, err)
+		}
+		if !reflect.DeepEqual(r.Players, want) {
+			t.Fatalf("app %v: got %+v, want %+v", appID, r.Players, want)
+		}
+	}
+	// The Ship fields are missing.
+	var r PlayersInfoResponse
+	if err := r.unmarshalBinary(shipPlayersResponse[:len(shipPlayersResponse)-16], appIDTheShip); err != errNotEnoughDataInResponse {
+		t.Fatalf("got %v, want %v", err, errNotEnoughDataInResponse)
+	}
+}
+
+func TestPlayersInfoResponseRoundTrip(t *testing.T) {
+	tests := []*PlayersInfoResponse{
+		{Players: []*Player{{Name: "a", Score: 1, Duration: 1.5}, {Name: "b", Score: 2, Duration: 2}}},
+		{Players: []*Player{{Name: "a", Score: 1, Duration: 1.5, Ship: &PlayerShipInfo{Deaths: 2, Money: 3}}}},
+		{},
+	}
+	for _, want := range tests {
+		data, err := want.marshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got PlayersInfoResponse
+		if err := got.unmarshalBinary(data[4:], 0); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Players, want.Players) {
+			t.Fatalf("got %+v, want %+v", got.Players, want.Players)
+		}
+	}
+}
+
+func TestInfoResponseRoundTrip(t *testing.T) {
+	want := &InfoResponse{
+		Protocol:     17,
+		Name:         "Server",
+		Map:          "de_dust2",
+		Folder:       "csgo",
+		Game:         "Counter-Strike: Global Offensive",
+		ID:           730,
+		Players:      10,
+		MaxPlayers:   24,
+		Bots:         2,
+		ServerType:   STDedicated,
+		Environment:  ELinux,
+		Visibility:   VPublic,
+		VAC:          VACSecure,
+		Version:      "1.38.0.0",
+		Port:         40000,
+		SteamID:      90071992547409920,
+		SourceTVPort: 27020,
+		SourceTVName: "GOTV",
+		Keywords:     "secure",
+		GameID:       730,
+	}
+	data, err := want.marshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got InfoResponse
+	if err := got.unmarshalBinary(data[4:]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Fatalf("got %+v, want %+v", &got, want)
+	}
+	if !bytes.HasPrefix(data, requestPrefix) {
+		t.Fatalf("missing packet header")
+	}
+}
+
+func TestInfoResponseObsolete(t *testing.T) {
+	// obsoleteInfo builds the 'm' response of an old GoldSrc server, with a
+	// mod block if mod is set.
+	obsoleteInfo := func(mod bool) []byte {
+		buf := new(bytes.Buffer)
+		writeByte(buf, hInfoObsoleteResponse)
+		writeString(buf, "192.168.0.1:27015")
+		writeString(buf, "Old Server")
+		writeString(buf, "crossfire")
+		writeString(buf, "valve")
+		writeString(buf, "Half-Life")
+		writeByte(buf, 5)
+		writeByte(buf, 16)
+		writeByte(buf, 47)
+		writeByte(buf, 'd')
+		writeByte(buf, 'w')
+		writeByte(buf, 1)
+		if mod {
+			writeByte(buf, 1)
+			writeString(buf, "http://example.com")
+			writeString(buf, "http://example.com/download")
+			writeByte(buf, 0)
+			writeLong(buf, 2)
+			writeLong(buf, 123456)
+			writeByte(buf, 1)
+			writeByte(buf, 0)
+		} else {
+			writeByte(buf, 0)
+		}
+		writeByte(buf, 1)
+		writeByte(buf, 3)
+		return buf.Bytes()
+	}
+	for _, mod := range []bool{false, true} {
+		want := &InfoResponse{
+			Address:     "192.168.0.1:27015",
+			Name:        "Old Server",
+			Map:         "crossfire",
+			Folder:      "valve",
+			Game:        "Half-Life",
+			Players:     5,
+			MaxPlayers:  16,
+			Protocol:    47,
+			ServerType:  STDedicated,
+			Environment: EWindows,
+			Visibility:  VPrivate,
+			VAC:         VACSecure,
+			Bots:        3,
+		}
+		if mod {
+			want.Mod = &ModInfo{
+				Link:            "http://example.com",
+				DownloadLink:    "http://example.com/download",
+				Version:         2,
+				Size:            123456,
+				MultiplayerOnly: true,
+			}
+		}
+		var got InfoResponse
+		if err := got.unmarshalBinary(obsoleteInfo(mod)); err != nil {
+			t.Fatalf("mod %v: %v", mod, err)
+		}
+		if !reflect.DeepEqual(&got, want) {
+			t.Fatalf("mod %v: got %+v, want %+v", mod, &got, want)
+		}
+	}
+	// A truncated response is rejected.
+	data := obsoleteInfo(true)
+	var got InfoResponse
+	if err := got.unmarshalBinary(data[:len(data)-5]); err == nil {
+		t.Fatal("truncated response was accepted")
+	}
+}
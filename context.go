@@ -0,0 +1,94 @@
+package steam
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// A deadline in the past, used to interrupt blocked I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// watchContext interrupts I/O blocked on conn once ctx is done. The
+// returned function must be called once the I/O is over; it clears the
+// deadlines again if they were used to interrupt it.
+func watchContext(ctx context.Context, conn deadliner) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+	return func() {
+		close(done)
+		if <-interrupted {
+			conn.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// contextDeadline returns the deadline of an operation allowed to run for
+// timeout, unless ctx expires earlier.
+func contextDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// contextError returns the error of ctx if it is done, as it caused err,
+// and err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// The read deadline may pass right before ctx notices its own.
+	if d, ok := ctx.Deadline(); ok && isTimeout(err) && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// dialContext calls dial, giving up once ctx is done. DialFn takes no
+// context, so a connection established after that is closed.
+func dialContext(ctx context.Context, dial DialFn, network, addr string) (net.Conn, error) {
+	if ctx.Done() == nil {
+		return dial(network, addr)
+	}
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := dial(network, addr)
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
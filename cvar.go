@@ -0,0 +1,284 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Cvar is a console variable of the server.
+type Cvar struct {
+	Name    string
+	Value   string
+	Default string
+	Min     string
+	Max     string
+	Flags   []string
+	Help    string
+
+	// Set for console commands listed by cvarlist, which have no value.
+	Command bool
+}
+
+// CvarList is the catalog of console variables and commands printed by
+// cvarlist.
+type CvarList []*Cvar
+
+// Lookup returns the cvar with the given name, or nil.
+func (l CvarList) Lookup(name string) *Cvar {
+	for _, c := range l {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Search returns the cvars whose name or help text contains s, ignoring
+// case.
+func (l CvarList) Search(s string) CvarList {
+	s = strings.ToLower(s)
+	var res CvarList
+	for _, c := range l {
+		if strings.Contains(strings.ToLower(c.Name), s) || strings.Contains(strings.ToLower(c.Help), s) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+var (
+	// "sv_cheats" = "0" ( def. "0" ) min. 0.000000 max. 1.000000 notify
+	cvarRE = regexp.MustCompile(`^"([^"]+)" = "(.*?)"(?: \( def\. "(.*?)" \))?(?:\s+(.*))?$`)
+	// "sv_gravity" is "800", as printed by GoldSrc servers.
+	goldSrcCvarRE = regexp.MustCompile(`^"([^"]+)" is "(.*)"$`)
+	// sv_cheats = false, as printed by CS2.
+	plainCvarRE = regexp.MustCompile(`^(\S+) = (.*)$`)
+)
+
+// Cvar retrieves the console variable with the given name. The name is
+// looked up with cvarlist first, so that console commands are never run.
+func (s *Server) Cvar(name string) (*Cvar, error) {
+	return s.CvarContext(context.Background(), name)
+}
+
+// CvarContext is like Cvar but stops waiting once ctx is done.
+func (s *Server) CvarContext(ctx context.Context, name string) (_ *Cvar, err error) {
+	defer func() {
+		if err != nil {
+			err = newOpError(OpRCONExec, s.rconAddr, err, nil)
+		}
+	}()
+	if err := s.checkCvar(ctx, name); err != nil {
+		return nil, err
+	}
+	return s.readCvar(ctx, name)
+}
+
+// SetCvar sets the console variable and checks that the server took the
+// new value. Its error matches ErrCvarNotSet if the server kept another
+// value, e.g. because the cvar is read-only or the value is out of range.
+// Like the one of Cvar, it matches ErrUnknownCvar for names cvarlist does
+// not list as a variable.
+func (s *Server) SetCvar(name, value string) error {
+	return s.SetCvarContext(context.Background(), name, value)
+}
+
+// SetCvarContext is like SetCvar but stops waiting once ctx is done.
+func (s *Server) SetCvarContext(ctx context.Context, name, value string) (err error) {
+	defer func() {
+		if err != nil {
+			err = newOpError(OpRCONExec, s.rconAddr, err, nil)
+		}
+	}()
+	if strings.ContainsAny(value, "\";\r\n") {
+		return ErrInvalidCvarValue
+	}
+	if err := s.checkCvar(ctx, name); err != nil {
+		return err
+	}
+	if _, err := s.SendContext(ctx, name+` "`+value+`"`); err != nil {
+		return err
+	}
+	c, err := s.readCvar(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !cvarValuesEqual(c.Value, value) {
+		return ErrCvarNotSet
+	}
+	return nil
+}
+
+// checkCvar returns ErrUnknownCvar unless cvarlist lists name as a
+// variable. Sending the bare name of a command, such as quit, would run it.
+func (s *Server) checkCvar(ctx context.Context, name string) error {
+	if !validCvarName(name) {
+		return ErrUnknownCvar
+	}
+	// cvarlist only prints the entries starting with its argument.
+	out, err := s.SendContext(ctx, "cvarlist "+name)
+	if err != nil {
+		return err
+	}
+	if c := ParseCvarList(out).Lookup(name); c == nil || c.Command {
+		return ErrUnknownCvar
+	}
+	return nil
+}
+
+// readCvar sends the bare name of a cvar, which prints its value.
+func (s *Server) readCvar(ctx context.Context, name string) (*Cvar, error) {
+	out, err := s.SendContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseCvar(name, out)
+}
+
+// CvarList retrieves the catalog printed by the cvarlist command.
+func (s *Server) CvarList() (CvarList, error) {
+	return s.CvarListContext(context.Background())
+}
+
+// CvarListContext is like CvarList but stops waiting once ctx is done.
+func (s *Server) CvarListContext(ctx context.Context) (CvarList, error) {
+	out, err := s.SendContext(ctx, "cvarlist")
+	if err != nil {
+		return nil, err
+	}
+	return ParseCvarList(out), nil
+}
+
+func validCvarName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\";\r\n")
+}
+
+// cvarValuesEqual compares values numerically if both are numbers, as the
+// server prints 1.0 back as 1.
+func cvarValuesEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && fa == fb
+}
+
+// parseCvar parses the output of a command consisting of a cvar name.
+func parseCvar(name, out string) (*Cvar, error) {
+	lines := strings.Split(strings.Replace(out, "\r", "", -1), "\n")
+	var c *Cvar
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if c == nil {
+			c = parseCvarLine(line)
+			if c != nil && !strings.EqualFold(c.Name, name) {
+				c = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "- ") {
+			help := []string{strings.TrimPrefix(line, "- ")}
+			for _, l := range lines[i+1:] {
+				if l = strings.TrimSpace(l); l != "" {
+					help = append(help, l)
+				}
+			}
+			c.Help = strings.Join(help, "\n")
+			break
+		}
+		// Older games print the flags on their own line.
+		c.Flags = append(c.Flags, strings.Fields(line)...)
+	}
+	if c == nil {
+		return nil, ErrUnknownCvar
+	}
+	return c, nil
+}
+
+// parseCvarLine parses the first line describing a cvar, or returns nil.
+func parseCvarLine(line string) *Cvar {
+	if m := cvarRE.FindStringSubmatch(line); m != nil {
+		c := &Cvar{Name: m[1], Value: m[2], Default: m[3]}
+		fields := strings.Fields(m[4])
+		for i := 0; i < len(fields); i++ {
+			switch {
+			case fields[i] == "min." && i+1 < len(fields):
+				c.Min = fields[i+1]
+				i++
+			case fields[i] == "max." && i+1 < len(fields):
+				c.Max = fields[i+1]
+				i++
+			default:
+				c.Flags = append(c.Flags, fields[i])
+			}
+		}
+		return c
+	}
+	if m := goldSrcCvarRE.FindStringSubmatch(line); m != nil {
+		return &Cvar{Name: m[1], Value: m[2]}
+	}
+	if m := plainCvarRE.FindStringSubmatch(line); m != nil {
+		return &Cvar{Name: m[1], Value: m[2]}
+	}
+	return nil
+}
+
+// ParseCvarList parses the output of the cvarlist command. Source games
+// print each entry as
+//
+//	sv_cheats : 0 : , "sv", "nf", "rep" : Allow cheats on server
+//
+// with "cmd" as the value of console commands. GoldSrc games only list
+// variables, with the flags following the value:
+//
+//	sv_gravity : 800 , sv
+func ParseCvarList(out string) CvarList {
+	var l CvarList
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimRight(line, "\r"), " : ", 4)
+		if len(parts) < 2 {
+			continue
+		}
+		if len(parts) == 2 {
+			value, flags := parts[1], ""
+			if i := strings.Index(value, ","); i >= 0 {
+				value, flags = value[:i], value[i+1:]
+			}
+			parts = []string{parts[0], value, flags}
+		}
+		c := &Cvar{
+			Name:  strings.TrimSpace(parts[0]),
+			Value: strings.TrimSpace(parts[1]),
+		}
+		if c.Name == "" || strings.Contains(c.Name, " ") {
+			continue
+		}
+		if c.Value == "cmd" {
+			c.Command = true
+			c.Value = ""
+		}
+		for _, f := range strings.Split(parts[2], ",") {
+			if f = strings.Trim(strings.TrimSpace(f), `"`); f != "" {
+				c.Flags = append(c.Flags, f)
+			}
+		}
+		if len(parts) == 4 {
+			c.Help = strings.TrimSpace(parts[3])
+		}
+		l = append(l, c)
+	}
+	return l
+}
+
+var (
+	ErrUnknownCvar      = errors.New("steam: unknown cvar")
+	ErrInvalidCvarValue = errors.New("steam: invalid cvar value")
+	ErrCvarNotSet       = errors.New("steam: cvar was not set")
+)
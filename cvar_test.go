@@ -0,0 +1,231 @@
+package steam
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCvar(t *testing.T) {
+	tests := []struct {
+		name string
+		cvar string
+		out  string
+		want *Cvar
+	}{
+		{
+			name: "srcds",
+			cvar: "sv_cheats",
+			out:  "\"sv_cheats\" = \"0\" ( def. \"0\" ) notify replicated\n - Allow cheats on server\n",
+			want: &Cvar{Name: "sv_cheats", Value: "0", Default: "0", Flags: []string{"notify", "replicated"}, Help: "Allow cheats on server"},
+		},
+		{
+			name: "srcds min max",
+			cvar: "mp_timelimit",
+			out:  "\"mp_timelimit\" = \"30\" ( def. \"0\" ) min. 0.000000 max. 1440.000000 game notify\n - game time per map in minutes\n",
+			want: &Cvar{Name: "mp_timelimit", Value: "30", Default: "0", Min: "0.000000", Max: "1440.000000", Flags: []string{"game", "notify"}, Help: "game time per map in minutes"},
+		},
+		{
+			name: "srcds flags on their own line",
+			cvar: "sv_cheats",
+			out:  "\"sv_cheats\" = \"0\" ( def. \"0\" )\r\n notify replicated\r\n - Allow cheats on server\r\n",
+			want: &Cvar{Name: "sv_cheats", Value: "0", Default: "0", Flags: []string{"notify", "replicated"}, Help: "Allow cheats on server"},
+		},
+		{
+			name: "srcds case",
+			cvar: "SV_Cheats",
+			out:  "\"sv_cheats\" = \"1\" ( def. \"0\" ) notify replicated\n - Allow cheats on server\n",
+			want: &Cvar{Name: "sv_cheats", Value: "1", Default: "0", Flags: []string{"notify", "replicated"}, Help: "Allow cheats on server"},
+		},
+		{
+			name: "hlds",
+			cvar: "sv_gravity",
+			out:  "\"sv_gravity\" is \"800\"\n",
+			want: &Cvar{Name: "sv_gravity", Value: "800"},
+		},
+		{
+			name: "cs2",
+			cvar: "sv_cheats",
+			out:  "sv_cheats = false\n",
+			want: &Cvar{Name: "sv_cheats", Value: "false"},
+		},
+		{
+			name: "srcds unknown",
+			cvar: "sv_foo",
+			out:  "Unknown command \"sv_foo\"\n",
+		},
+		{
+			name: "hlds unknown",
+			cvar: "sv_foo",
+			out:  "Unknown command: sv_foo\n",
+		},
+		{
+			name: "other cvar",
+			cvar: "sv_foo",
+			out:  "\"sv_cheats\" = \"0\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCvar(tt.cvar, tt.out)
+			if tt.want == nil {
+				if err != ErrUnknownCvar {
+					t.Fatalf("got error %v, want %v", err, ErrUnknownCvar)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCvarList(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want CvarList
+	}{
+		{
+			name: "srcds",
+			out: `cvar list
+--------------
+_autosave                                : cmd      :                  : Autosave
+quit                                     : cmd      :                  : Exit the engine.
+sv_cheats                                : 0        : , "sv", "nf", "rep" : Allow cheats on server
+sv_tags                                  :          : , "nf"           : Server tags. Used to provide extra information to clients when they're browsing for servers. Separate tags with a comma.
+--------------
+  4 total convars/concommands
+`,
+			want: CvarList{
+				{Name: "_autosave", Help: "Autosave", Command: true},
+				{Name: "quit", Help: "Exit the engine.", Command: true},
+				{Name: "sv_cheats", Value: "0", Flags: []string{"sv", "nf", "rep"}, Help: "Allow cheats on server"},
+				{Name: "sv_tags", Flags: []string{"nf"}, Help: "Server tags. Used to provide extra information to clients when they're browsing for servers. Separate tags with a comma."},
+			},
+		},
+		{
+			name: "cs2",
+			out: `sv_cheats                                        : false    : sv, rep, nf                        : Allow cheats on server
+status                                           : cmd      : release                            : Display map and connection status.
+`,
+			want: CvarList{
+				{Name: "sv_cheats", Value: "false", Flags: []string{"sv", "rep", "nf"}, Help: "Allow cheats on server"},
+				{Name: "status", Flags: []string{"release"}, Help: "Display map and connection status.", Command: true},
+			},
+		},
+		{
+			name: "hlds",
+			out: `CVar List
+--------------
+hostname                     : Half-Life
+sv_aim                       : 0        , a
+sv_gravity                   : 800      , sv
+sv_password                  : ""       , sv
+--------------
+4 CVars for [sv]
+`,
+			want: CvarList{
+				{Name: "hostname", Value: "Half-Life"},
+				{Name: "sv_aim", Value: "0", Flags: []string{"a"}},
+				{Name: "sv_gravity", Value: "800", Flags: []string{"sv"}},
+				{Name: "sv_password", Value: `""`, Flags: []string{"sv"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseCvarList(tt.out)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v entries, want %v", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				if !reflect.DeepEqual(c, tt.want[i]) {
+					t.Errorf("entry %v: got %+v, want %+v", i, *c, *tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// startCvarServer serves sv_cheats like srcds does. The server must be
+// closed.
+func startCvarServer(t *testing.T) (*RCONServer, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := "0"
+	s := NewRCONServer(RCONHandlerFunc(func(cmd string, _ net.Addr) string {
+		switch {
+		case strings.HasPrefix(cmd, "cvarlist "):
+			list := "sv_cheats : " + value + ` : , "sv", "nf", "rep" : Allow cheats on server` + "\n" +
+				"quit : cmd : : Exit the engine.\n"
+			var out string
+			for _, line := range strings.SplitAfter(list, "\n") {
+				if line != "" && strings.HasPrefix(line, cmd[len("cvarlist "):]) {
+					out += line
+				}
+			}
+			return out
+		case cmd == "sv_cheats":
+			return `"sv_cheats" = "` + value + `" ( def. "0" ) notify replicated` + "\n - Allow cheats on server\n"
+		case strings.HasPrefix(cmd, `sv_cheats "`):
+			// Only 0 and 1 are taken.
+			if v := strings.Trim(cmd[len("sv_cheats "):], `"`); v == "0" || v == "1" {
+				value = v
+			}
+			return ""
+		}
+		t.Errorf("unexpected command %q", cmd)
+		return ""
+	}), &RCONServerOptions{Password: "secret"})
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func TestServerCvar(t *testing.T) {
+	rs, addr := startCvarServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c, err := s.Cvar("sv_cheats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Value != "0" || c.Default != "0" {
+		t.Fatalf("got %+v", *c)
+	}
+	if err := s.SetCvar("sv_cheats", "1"); err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetCvar("sv_cheats", "2")
+	if !errors.Is(err, ErrCvarNotSet) {
+		t.Fatalf("got error %v, want %v", err, ErrCvarNotSet)
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Op != OpRCONExec || oe.Addr != addr {
+		t.Fatalf("got error %#v, want an *OpError of %v", err, OpRCONExec)
+	}
+	// None of these may reach the server on its own: quit is a command,
+	// sv_foo is not listed and the last one holds a command separator.
+	for _, name := range []string{"quit", "sv_foo", "sv_cheats;quit"} {
+		if _, err := s.Cvar(name); !errors.Is(err, ErrUnknownCvar) {
+			t.Fatalf("%v: got error %v, want %v", name, err, ErrUnknownCvar)
+		}
+		if err := s.SetCvar(name, "1"); !errors.Is(err, ErrUnknownCvar) {
+			t.Fatalf("%v: got error %v, want %v", name, err, ErrUnknownCvar)
+		}
+	}
+	if err := s.SetCvar("sv_cheats", `1"`); !errors.Is(err, ErrInvalidCvarValue) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidCvarValue)
+	}
+}
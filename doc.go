@@ -1,4 +1,10 @@
 /*
-	Package steam allows querying of Source servers.
+Package steam allows querying of Source servers.
+
+The methods taking a context.Context stop waiting for the network once it
+is done. The context only bounds the I/O, not the wait for the locks of a
+Server: a GoldSrc RCON command waits for the one before it to finish, and
+a Source RCON command for the connection to be opened, however long that
+takes.
 */
 package steam
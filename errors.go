@@ -0,0 +1,109 @@
+package steam
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// Op is the operation an OpError happened in.
+type Op int
+
+func (o Op) String() string {
+	if s, ok := opStrings[o]; ok {
+		return s
+	}
+	return "op(" + strconv.Itoa(int(o)) + ")"
+}
+
+const (
+	OpInfo Op = iota
+	OpPlayers
+	OpRules
+	// OpRCONAuth covers connecting and authenticating, or fetching the
+	// challenge for GoldSrc RCON.
+	OpRCONAuth
+	OpRCONExec
+)
+
+var opStrings = map[Op]string{
+	OpInfo:     "info",
+	OpPlayers:  "players",
+	OpRules:    "rules",
+	OpRCONAuth: "rcon-auth",
+	OpRCONExec: "rcon-exec",
+}
+
+// OpError is the error returned by queries and RCON commands. Err holds
+// the cause, which errors.Is and errors.As look into, e.g. ErrRCONAuthFailed,
+// ErrMalformedPacket, a context error or a *net.OpError.
+type OpError struct {
+	Op   Op
+	Addr string
+
+	// Hex dump of the packet which could not be decoded. Empty for other
+	// errors.
+	Dump string
+
+	Err error
+}
+
+func (e *OpError) Error() string {
+	s := e.Op.String() + " " + e.Addr
+	if e.Err == nil {
+		return s + ": unknown error"
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the operation timed out.
+func (e *OpError) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return errors.As(e.Err, &t) && t.Timeout()
+}
+
+// Temporary reports whether the cause is temporary. Along with Timeout, it
+// lets OpError stand in for the net.Error it may wrap.
+func (e *OpError) Temporary() bool {
+	var t interface{ Temporary() bool }
+	return errors.As(e.Err, &t) && t.Temporary()
+}
+
+// newOpError returns err as an *OpError, with the dump of packet if given
+// or carried by err. Errors which already are one are returned as is.
+func newOpError(op Op, addr string, err error, packet []byte) error {
+	if _, ok := err.(*OpError); ok {
+		return err
+	}
+	var pe *packetError
+	if packet == nil && errors.As(err, &pe) {
+		packet = pe.packet
+	}
+	e := &OpError{Op: op, Addr: addr, Err: err}
+	if packet != nil {
+		e.Dump = hex.Dump(packet)
+	}
+	return e
+}
+
+// ErrMalformedPacket is matched by the errors of packets which could not
+// be decoded.
+var ErrMalformedPacket = errors.New("steam: malformed packet")
+
+// packetError carries the packet err happened on, for the dump of OpError.
+type packetError struct {
+	err    error
+	packet []byte
+}
+
+func (e *packetError) Error() string {
+	return e.err.Error()
+}
+
+func (e *packetError) Unwrap() error {
+	return e.err
+}
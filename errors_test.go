@@ -0,0 +1,110 @@
+package steam
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// startUDPServer answers every packet with reply, or never if it is nil.
+// The connection must be closed.
+func startUDPServer(t *testing.T, reply []byte) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply != nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestOpErrorTimeout(t *testing.T) {
+	conn := startUDPServer(t, nil)
+	defer conn.Close()
+	addr := conn.LocalAddr().String()
+	s, err := Connect(addr, &ConnectOptions{QueryTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, err = s.Info()
+	var oe *OpError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got %T, want *OpError", err)
+	}
+	if oe.Op != OpInfo || oe.Addr != addr || oe.Dump != "" {
+		t.Fatalf("got %+v", oe)
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() || !isTimeout(err) {
+		t.Fatalf("%v: not a timeout", err)
+	}
+}
+
+func TestOpErrorAuth(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	_, err := Connect(addr, &ConnectOptions{RCONPassword: "wrong"})
+	if !errors.Is(err, ErrRCONAuthFailed) {
+		t.Fatalf("got %v, want %v", err, ErrRCONAuthFailed)
+	}
+	var oe *OpError
+	if !errors.As(err, &oe) || oe.Op != OpRCONAuth || oe.Addr != addr {
+		t.Fatalf("got %#v", err)
+	}
+	if oe.Timeout() || isTimeout(err) {
+		t.Fatalf("%v: reported as a timeout", err)
+	}
+}
+
+func TestOpErrorMalformedPacket(t *testing.T) {
+	// An info response cut off after the protocol version.
+	reply := []byte{0xFF, 0xFF, 0xFF, 0xFF, hInfoResponse, 17, 'S', 'e', 'r'}
+	conn := startUDPServer(t, reply)
+	defer conn.Close()
+	addr := conn.LocalAddr().String()
+	s, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, err = s.Info()
+	if !errors.Is(err, ErrMalformedPacket) {
+		t.Fatalf("got %v, want %v", err, ErrMalformedPacket)
+	}
+	var oe *OpError
+	if !errors.As(err, &oe) || oe.Op != OpInfo || oe.Addr != addr {
+		t.Fatalf("got %#v", err)
+	}
+	if want := hex.Dump(reply[4:]); oe.Dump != want {
+		t.Fatalf("got dump\n%v\nwant\n%v", oe.Dump, want)
+	}
+}
+
+func TestOpErrorString(t *testing.T) {
+	tests := []struct {
+		err  *OpError
+		want string
+	}{
+		{&OpError{Op: OpRules, Addr: "1.2.3.4:27015", Err: errBadData}, "rules 1.2.3.4:27015: steam: bad data in response"},
+		{&OpError{Op: Op(42), Addr: "1.2.3.4:27015", Err: errBadData}, "op(42) 1.2.3.4:27015: steam: bad data in response"},
+		{&OpError{Op: OpRCONExec, Addr: "1.2.3.4:27015"}, "rcon-exec 1.2.3.4:27015: unknown error"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
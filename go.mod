@@ -0,0 +1,11 @@
+module github.com/kidoman/go-steam
+
+go 1.13
+
+require github.com/sirupsen/logrus v0.0.0-20180523074243-ea8897e79973
+
+require (
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1 // indirect
+)
@@ -0,0 +1,229 @@
+package steam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RCONProtocol is the protocol used to send RCON commands.
+type RCONProtocol int
+
+func (p RCONProtocol) String() string {
+	return rconProtocolStrings[p]
+}
+
+const (
+	// RPSource is the TCP based protocol of Source servers.
+	RPSource RCONProtocol = iota
+	// RPGoldSrc is the UDP based protocol of GoldSrc servers.
+	RPGoldSrc
+)
+
+var rconProtocolStrings = map[RCONProtocol]string{
+	RPSource:  "Source",
+	RPGoldSrc: "GoldSrc",
+}
+
+const (
+	hGoldSrcRCONChallengeResponse = 'c'
+	hGoldSrcRCONResponse          = 'l'
+)
+
+// Time to wait for more packets of a GoldSrc RCON response once the first
+// one arrived.
+const goldSrcRCONIdleTimeout = 200 * time.Millisecond
+
+// GoldSrc servers flush long output in packets of up to 1400 bytes, once
+// the next line would not fit. Only replies of at least this size may be
+// followed by more, so only then is the idle timeout waited for.
+const goldSrcRCONFlushSize = 1000
+
+// Replies of GoldSrc servers to rejected commands.
+const (
+	goldSrcRCONBadPassword  = "Bad rcon_password."
+	goldSrcRCONBanned       = "You have been banned from this server."
+	goldSrcRCONBadChallenge = "Bad challenge."
+)
+
+type goldSrcRCONChallengeRequest struct {
+}
+
+func (goldSrcRCONChallengeRequest) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	buf.WriteString("challenge rcon\n")
+	return buf.Bytes(), nil
+}
+
+type goldSrcRCONChallengeResponse struct {
+	Challenge string
+}
+
+func (r *goldSrcRCONChallengeResponse) unmarshalBinary(data []byte) error {
+	fields := strings.Fields(strings.TrimRight(string(data), "\x00"))
+	if len(fields) != 3 || fields[0] != "challenge" || fields[1] != "rcon" {
+		return errBadData
+	}
+	r.Challenge = fields[2]
+	return nil
+}
+
+type goldSrcRCONRequest struct {
+	Challenge string
+	Password  string
+	Command   string
+}
+
+func (r goldSrcRCONRequest) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeRequestPrefix(buf)
+	fmt.Fprintf(buf, "rcon %v \"%v\" %v\n", r.Challenge, r.Password, r.Command)
+	return buf.Bytes(), nil
+}
+
+type goldSrcRCONResponse struct {
+	Body string
+}
+
+func (r *goldSrcRCONResponse) unmarshalBinary(data []byte) error {
+	if len(data) > 0 && data[0] == hGoldSrcRCONResponse {
+		data = data[1:]
+	}
+	r.Body = strings.TrimRight(string(data), "\x00")
+	return nil
+}
+
+func (s *Server) initGoldSrcRCON(ctx context.Context) error {
+	// The password is sent in quotes, which GoldSrc has no escape for.
+	if strings.ContainsRune(s.rconPassword, '"') {
+		return errGoldSrcRCONPasswordQuote
+	}
+	log.WithFields(logrus.Fields{
+		"addr": s.rconAddr,
+	}).Debug("steam: requesting goldsrc rcon challenge")
+	usock, err := s.newRCONUDPSocket(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: could not open udp socket")
+		return err
+	}
+	s.rconUDPSock = usock
+	if err := s.goldSrcRCONChallenge(ctx); err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: could not get goldsrc rcon challenge")
+		s.dropGoldSrcRCONSocket()
+		return err
+	}
+	s.rconInitialized = true
+	return nil
+}
+
+func (s *Server) goldSrcRCONChallenge(ctx context.Context) error {
+	req, _ := goldSrcRCONChallengeRequest{}.marshalBinary()
+	if err := s.rconUDPSock.send(req); err != nil {
+		return err
+	}
+	data, err := s.rconUDPSock.receive(ctx, hGoldSrcRCONChallengeResponse)
+	if err != nil {
+		return err
+	}
+	var res goldSrcRCONChallengeResponse
+	if err := res.unmarshalBinary(data); err != nil {
+		return &packetError{err, data}
+	}
+	s.rconChallenge = res.Challenge
+	return nil
+}
+
+// sendGoldSrc sends an RCON command over UDP. The challenge is fetched
+// again if the server no longer accepts it.
+func (s *Server) sendGoldSrc(ctx context.Context, cmd string) (string, error) {
+	if s.rconUDPSock == nil {
+		if err := s.initGoldSrcRCON(ctx); err != nil {
+			return "", err
+		}
+	}
+	out, err := s.execGoldSrc(ctx, cmd)
+	if err != errGoldSrcRCONBadChallenge {
+		return out, err
+	}
+	log.Debug("steam: goldsrc rcon challenge expired")
+	if err := s.goldSrcRCONChallenge(ctx); err != nil {
+		s.dropGoldSrcRCONSocket()
+		return "", err
+	}
+	return s.execGoldSrc(ctx, cmd)
+}
+
+func (s *Server) execGoldSrc(ctx context.Context, cmd string) (string, error) {
+	req, _ := goldSrcRCONRequest{s.rconChallenge, s.rconPassword, cmd}.marshalBinary()
+	if err := s.rconUDPSock.send(req); err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: sending goldsrc rcon request")
+		return "", err
+	}
+	data, err := s.rconUDPSock.receive(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: receiving goldsrc rcon response")
+		s.dropGoldSrcRCONSocket()
+		return "", err
+	}
+	var buf bytes.Buffer
+	for {
+		var res goldSrcRCONResponse
+		if err := res.unmarshalBinary(data); err != nil {
+			return "", err
+		}
+		buf.WriteString(res.Body)
+		// Long output may be sent as several responses, so keep reading
+		// until the server goes quiet, unless the reply was too short to
+		// have been flushed early.
+		if len(data) < goldSrcRCONFlushSize {
+			break
+		}
+		data, err = s.rconUDPSock.receiveTimeout(ctx, goldSrcRCONIdleTimeout)
+		if err != nil {
+			// More output may still be on its way.
+			s.dropGoldSrcRCONSocket()
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	out := buf.String()
+	switch strings.TrimSpace(out) {
+	case goldSrcRCONBadPassword:
+		return "", ErrRCONAuthFailed
+	case goldSrcRCONBanned:
+		return "", ErrRCONBanned
+	case goldSrcRCONBadChallenge:
+		return "", errGoldSrcRCONBadChallenge
+	}
+	return out, nil
+}
+
+// dropGoldSrcRCONSocket closes the socket after a command whose output may
+// still arrive. As every reply has the same header, it would be read as
+// the output of the next command, which opens a new socket and fetches a
+// new challenge instead.
+func (s *Server) dropGoldSrcRCONSocket() {
+	s.rconUDPSock.close()
+	s.rconUDPSock = nil
+}
+
+var (
+	errGoldSrcRCONBadChallenge  = errors.New("steam: bad goldsrc rcon challenge")
+	errGoldSrcRCONPasswordQuote = errors.New("steam: goldsrc rcon password cannot contain quotes")
+)
@@ -0,0 +1,146 @@
+package steam
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startGoldSrcRCONServer answers GoldSrc RCON requests on a local port. The
+// first challenge handed out is rejected as expired. The command "long"
+// prints output spanning two packets, "slow" answers after 300ms, "late"
+// sends its second packet after 300ms and others are echoed. The
+// connection must be closed.
+func startGoldSrcRCONServer(t *testing.T, password string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		challenges := 0
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			reply := func(s string) {
+				conn.WriteTo(append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, s...), addr)
+			}
+			req := string(buf[4:n])
+			if req == "challenge rcon\n" {
+				challenges++
+				reply("challenge rcon " + strings.Repeat("1", challenges) + "\n\x00")
+				continue
+			}
+			fields := strings.SplitN(strings.TrimSuffix(req, "\n"), " ", 4)
+			switch {
+			case len(fields) != 4 || fields[0] != "rcon":
+				continue
+			case fields[1] == "1":
+				reply("lBad challenge.\n\x00")
+			case fields[2] != `"`+password+`"`:
+				reply("lBad rcon_password.\n\x00")
+			case fields[3] == "long":
+				reply("l" + strings.Repeat("x", 1300) + "\n\x00")
+				reply("lend\n\x00")
+			case fields[3] == "slow":
+				time.AfterFunc(300*time.Millisecond, func() {
+					reply("lslow-output\n\x00")
+				})
+			case fields[3] == "late":
+				reply("l" + strings.Repeat("x", 1300) + "\n\x00")
+				time.AfterFunc(300*time.Millisecond, func() {
+					reply("llate-output\n\x00")
+				})
+			default:
+				reply("l" + fields[3] + "\n\x00")
+			}
+		}
+	}()
+	return conn
+}
+
+func TestGoldSrcRCON(t *testing.T) {
+	conn := startGoldSrcRCONServer(t, "secret")
+	defer conn.Close()
+	s, err := NewRCONClient(conn.LocalAddr().String(), &ConnectOptions{RCONPassword: "secret", RCONProtocol: RPGoldSrc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	out, err := s.Send("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "status\n" {
+		t.Fatalf("got %q, want %q", out, "status\n")
+	}
+	// A short reply is not followed by more, so it is not waited for.
+	if d := time.Since(start); d >= goldSrcRCONIdleTimeout {
+		t.Fatalf("short reply took %v", d)
+	}
+
+	out, err = s.Send("long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("x", 1300) + "\nend\n"; out != want {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+}
+
+func TestGoldSrcRCONBadPassword(t *testing.T) {
+	conn := startGoldSrcRCONServer(t, "secret")
+	defer conn.Close()
+	for _, password := range []string{"wrong", `se"cret`} {
+		s, err := NewRCONClient(conn.LocalAddr().String(), &ConnectOptions{RCONPassword: password, RCONProtocol: RPGoldSrc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Send("status")
+		s.Close()
+		if password == "wrong" && !errors.Is(err, ErrRCONAuthFailed) {
+			t.Fatalf("got %v, want %v", err, ErrRCONAuthFailed)
+		}
+		if password != "wrong" && !errors.Is(err, errGoldSrcRCONPasswordQuote) {
+			t.Fatalf("got %v, want %v", err, errGoldSrcRCONPasswordQuote)
+		}
+	}
+}
+
+func TestGoldSrcRCONLateOutput(t *testing.T) {
+	conn := startGoldSrcRCONServer(t, "secret")
+	defer conn.Close()
+	s, err := NewRCONClient(conn.LocalAddr().String(), &ConnectOptions{
+		RCONPassword: "secret",
+		RCONProtocol: RPGoldSrc,
+		RCONTimeout:  100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("slow"); err == nil {
+		t.Fatal("slow command did not time out")
+	}
+	if _, err := s.Send("late"); err != nil {
+		t.Fatal(err)
+	}
+	// The output of the commands above arrives meanwhile, and must not be
+	// taken for the one of the next commands.
+	for i := 0; i < 3; i++ {
+		time.Sleep(150 * time.Millisecond)
+		out, err := s.Send("echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "echo\n" {
+			t.Fatalf("got %q, want %q", out, "echo\n")
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package steam
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// LogEvent is an event parsed from a line in the Half-Life log standard
+// format. It is one of the *Event types of this package.
+type LogEvent interface {
+	logEvent()
+}
+
+// LogPlayer identifies a player in a log line, written as
+// "Name<uid><STEAM_ID><team>".
+type LogPlayer struct {
+	Name    string
+	UserID  int
+	SteamID string
+	Team    string
+
+	// Only set if the game logs player positions.
+	Position *LogPosition
+}
+
+// LogPosition is a position in the world, written as "[x y z]".
+type LogPosition struct {
+	X, Y, Z float64
+}
+
+// KillEvent is logged when a player kills another.
+type KillEvent struct {
+	Killer LogPlayer
+	Victim LogPlayer
+	Weapon string
+
+	// Extra properties such as "headshot", which have no value.
+	Properties map[string]string
+}
+
+// SayEvent is logged when a player chats.
+type SayEvent struct {
+	Player LogPlayer
+	Text   string
+	Team   bool
+
+	Properties map[string]string
+}
+
+// ConnectedEvent is logged when a player connects.
+type ConnectedEvent struct {
+	Player  LogPlayer
+	Address string
+}
+
+// EnteredEvent is logged when a player enters the game.
+type EnteredEvent struct {
+	Player LogPlayer
+}
+
+// DisconnectedEvent is logged when a player leaves.
+type DisconnectedEvent struct {
+	Player LogPlayer
+	Reason string
+}
+
+// JoinedTeamEvent is logged when a player joins a team.
+type JoinedTeamEvent struct {
+	Player LogPlayer
+	Team   string
+}
+
+// ChangedRoleEvent is logged when a player changes role or class.
+type ChangedRoleEvent struct {
+	Player LogPlayer
+	Role   string
+}
+
+// ChangedNameEvent is logged when a player changes name.
+type ChangedNameEvent struct {
+	Player LogPlayer
+	Name   string
+}
+
+// TriggeredEvent is logged for game specific actions. It is triggered by
+// either a player, a team or the world.
+type TriggeredEvent struct {
+	Action string
+
+	// Set if a player triggered the action.
+	Player *LogPlayer
+	// Set if the action was triggered against another player.
+	Victim *LogPlayer
+	// Set if a team triggered the action.
+	Team string
+
+	Properties map[string]string
+}
+
+// MapLoadingEvent is logged when the server starts loading a map.
+type MapLoadingEvent struct {
+	Map string
+}
+
+// MapStartedEvent is logged once the map is loaded.
+type MapStartedEvent struct {
+	Map string
+	CRC string
+}
+
+// RCONEvent is logged when the server receives an RCON command.
+type RCONEvent struct {
+	Address string
+	Command string
+
+	// Set if the password was wrong.
+	BadPassword bool
+}
+
+// GenericEvent holds a line no other event matched.
+type GenericEvent struct {
+	Text string
+}
+
+func (*KillEvent) logEvent()         {}
+func (*SayEvent) logEvent()          {}
+func (*ConnectedEvent) logEvent()    {}
+func (*EnteredEvent) logEvent()      {}
+func (*DisconnectedEvent) logEvent() {}
+func (*JoinedTeamEvent) logEvent()   {}
+func (*ChangedRoleEvent) logEvent()  {}
+func (*ChangedNameEvent) logEvent()  {}
+func (*TriggeredEvent) logEvent()    {}
+func (*MapLoadingEvent) logEvent()   {}
+func (*MapStartedEvent) logEvent()   {}
+func (*RCONEvent) logEvent()         {}
+func (*GenericEvent) logEvent()      {}
+
+const (
+	// Each match adds 4 submatches for the player and 3 for the position.
+	logPlayer     = `"(.*?)<(-?\d+)><([^<>]*)><([^<>]*)>"`
+	logPosition   = `(?: \[(-?[\d.]+) (-?[\d.]+) (-?[\d.]+)\])?`
+	logProperties = `((?: \([^()]*\))*)`
+)
+
+var (
+	killEventRE         = regexp.MustCompile(`^` + logPlayer + logPosition + ` killed ` + logPlayer + logPosition + ` with "([^"]*)"` + logProperties + `$`)
+	sayEventRE          = regexp.MustCompile(`^` + logPlayer + logPosition + ` (say|say_team) "(.*)"` + logProperties + `$`)
+	connectedEventRE    = regexp.MustCompile(`^` + logPlayer + ` connected, address "([^"]*)"$`)
+	enteredEventRE      = regexp.MustCompile(`^` + logPlayer + ` entered the game$`)
+	disconnectedEventRE = regexp.MustCompile(`^` + logPlayer + ` disconnected(?: \(reason "(.*)"\))?$`)
+	joinedTeamEventRE   = regexp.MustCompile(`^` + logPlayer + ` joined team "([^"]*)"$`)
+	changedRoleEventRE  = regexp.MustCompile(`^` + logPlayer + ` changed role to "([^"]*)"$`)
+	changedNameEventRE  = regexp.MustCompile(`^` + logPlayer + ` changed name to "(.*)"$`)
+	playerTriggeredRE   = regexp.MustCompile(`^` + logPlayer + logPosition + ` triggered "([^"]*)"(?: against ` + logPlayer + logPosition + `)?` + logProperties + `$`)
+	teamTriggeredRE     = regexp.MustCompile(`^Team "([^"]*)" triggered "([^"]*)"` + logProperties + `$`)
+	worldTriggeredRE    = regexp.MustCompile(`^World triggered "([^"]*)"` + logProperties + `$`)
+	mapLoadingEventRE   = regexp.MustCompile(`^Loading map "([^"]*)"$`)
+	mapStartedEventRE   = regexp.MustCompile(`^Started map "([^"]*)"(?: \(CRC "([^"]*)"\))?$`)
+	// GoldSrc logs the full request, Source servers only the command.
+	goldSrcRCONEventRE = regexp.MustCompile(`^(Bad )?Rcon: "rcon \S+ "[^"]*" (.*)" from "([^"]*)"$`)
+	sourceRCONEventRE  = regexp.MustCompile(`^rcon from "([^"]*)": (?:command "(.*)"|(Bad Password))$`)
+
+	logPropertyRE = regexp.MustCompile(`\((\w+)(?: "([^"]*)")?\)`)
+)
+
+// ParseLogEvent parses the text of a log line, without its timestamp.
+// Lines which match no known event are returned as a *GenericEvent.
+func ParseLogEvent(text string) LogEvent {
+	if m := killEventRE.FindStringSubmatch(text); m != nil {
+		return &KillEvent{
+			Killer:     parseLogPlayer(m[1:8]),
+			Victim:     parseLogPlayer(m[8:15]),
+			Weapon:     m[15],
+			Properties: parseLogProperties(m[16]),
+		}
+	}
+	if m := sayEventRE.FindStringSubmatch(text); m != nil {
+		return &SayEvent{
+			Player:     parseLogPlayer(m[1:8]),
+			Team:       m[8] == "say_team",
+			Text:       m[9],
+			Properties: parseLogProperties(m[10]),
+		}
+	}
+	if m := connectedEventRE.FindStringSubmatch(text); m != nil {
+		return &ConnectedEvent{Player: parseLogPlayer(m[1:5]), Address: m[5]}
+	}
+	if m := enteredEventRE.FindStringSubmatch(text); m != nil {
+		return &EnteredEvent{Player: parseLogPlayer(m[1:5])}
+	}
+	if m := disconnectedEventRE.FindStringSubmatch(text); m != nil {
+		return &DisconnectedEvent{Player: parseLogPlayer(m[1:5]), Reason: m[5]}
+	}
+	if m := joinedTeamEventRE.FindStringSubmatch(text); m != nil {
+		return &JoinedTeamEvent{Player: parseLogPlayer(m[1:5]), Team: m[5]}
+	}
+	if m := changedRoleEventRE.FindStringSubmatch(text); m != nil {
+		return &ChangedRoleEvent{Player: parseLogPlayer(m[1:5]), Role: m[5]}
+	}
+	if m := changedNameEventRE.FindStringSubmatch(text); m != nil {
+		return &ChangedNameEvent{Player: parseLogPlayer(m[1:5]), Name: m[5]}
+	}
+	if m := playerTriggeredRE.FindStringSubmatch(text); m != nil {
+		player := parseLogPlayer(m[1:8])
+		e := &TriggeredEvent{
+			Action:     m[8],
+			Player:     &player,
+			Properties: parseLogProperties(m[16]),
+		}
+		if m[9] != "" || m[10] != "" {
+			victim := parseLogPlayer(m[9:16])
+			e.Victim = &victim
+		}
+		return e
+	}
+	if m := teamTriggeredRE.FindStringSubmatch(text); m != nil {
+		return &TriggeredEvent{Team: m[1], Action: m[2], Properties: parseLogProperties(m[3])}
+	}
+	if m := worldTriggeredRE.FindStringSubmatch(text); m != nil {
+		return &TriggeredEvent{Action: m[1], Properties: parseLogProperties(m[2])}
+	}
+	if m := mapLoadingEventRE.FindStringSubmatch(text); m != nil {
+		return &MapLoadingEvent{Map: m[1]}
+	}
+	if m := mapStartedEventRE.FindStringSubmatch(text); m != nil {
+		return &MapStartedEvent{Map: m[1], CRC: m[2]}
+	}
+	if m := goldSrcRCONEventRE.FindStringSubmatch(text); m != nil {
+		return &RCONEvent{BadPassword: m[1] != "", Command: m[2], Address: m[3]}
+	}
+	if m := sourceRCONEventRE.FindStringSubmatch(text); m != nil {
+		return &RCONEvent{Address: m[1], Command: m[2], BadPassword: m[3] != ""}
+	}
+	return &GenericEvent{Text: text}
+}
+
+// Event parses the text of the line.
+func (l *LogLine) Event() LogEvent {
+	return ParseLogEvent(l.Text)
+}
+
+// parseLogPlayer builds a player from the submatches of logPlayer,
+// optionally followed by those of logPosition.
+func parseLogPlayer(m []string) LogPlayer {
+	p := LogPlayer{
+		Name:    m[0],
+		SteamID: m[2],
+		Team:    m[3],
+	}
+	p.UserID, _ = strconv.Atoi(m[1])
+	if len(m) < 7 || m[4] == "" {
+		return p
+	}
+	var pos LogPosition
+	pos.X, _ = strconv.ParseFloat(m[4], 64)
+	pos.Y, _ = strconv.ParseFloat(m[5], 64)
+	pos.Z, _ = strconv.ParseFloat(m[6], 64)
+	p.Position = &pos
+	return p
+}
+
+// parseLogProperties parses trailing properties such as
+// ` (headshot) (damage "100")`.
+func parseLogProperties(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	props := make(map[string]string)
+	for _, m := range logPropertyRE.FindAllStringSubmatch(s, -1) {
+		props[m[1]] = m[2]
+	}
+	return props
+}
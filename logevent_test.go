@@ -0,0 +1,229 @@
+package steam
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLogEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want LogEvent
+	}{
+		{
+			name: "csgo kill with positions",
+			text: `"Player<2><STEAM_1:0:12345><CT>" [-1200 345 -120] killed "Bot Joe<3><BOT><TERRORIST>" [-1100.5 300 -100] with "ak47" (headshot)`,
+			want: &KillEvent{
+				Killer:     LogPlayer{Name: "Player", UserID: 2, SteamID: "STEAM_1:0:12345", Team: "CT", Position: &LogPosition{-1200, 345, -120}},
+				Victim:     LogPlayer{Name: "Bot Joe", UserID: 3, SteamID: "BOT", Team: "TERRORIST", Position: &LogPosition{-1100.5, 300, -100}},
+				Weapon:     "ak47",
+				Properties: map[string]string{"headshot": ""},
+			},
+		},
+		{
+			name: "tf2 kill with properties",
+			text: `"Scout<5><[U:1:12345]><Red>" killed "Heavy<6><[U:1:67890]><Blue>" with "scattergun" (customkill "headshot") (attacker_position "-1234 567 89") (victim_position "-1200 560 89")`,
+			want: &KillEvent{
+				Killer: LogPlayer{Name: "Scout", UserID: 5, SteamID: "[U:1:12345]", Team: "Red"},
+				Victim: LogPlayer{Name: "Heavy", UserID: 6, SteamID: "[U:1:67890]", Team: "Blue"},
+				Weapon: "scattergun",
+				Properties: map[string]string{
+					"customkill":        "headshot",
+					"attacker_position": "-1234 567 89",
+					"victim_position":   "-1200 560 89",
+				},
+			},
+		},
+		{
+			name: "hlds kill",
+			text: `"Player<1><STEAM_0:0:1234><CT>" killed "Enemy<2><STEAM_0:1:5678><TERRORIST>" with "m4a1"`,
+			want: &KillEvent{
+				Killer: LogPlayer{Name: "Player", UserID: 1, SteamID: "STEAM_0:0:1234", Team: "CT"},
+				Victim: LogPlayer{Name: "Enemy", UserID: 2, SteamID: "STEAM_0:1:5678", Team: "TERRORIST"},
+				Weapon: "m4a1",
+			},
+		},
+		{
+			name: "say",
+			text: `"Player<2><STEAM_1:0:12345><CT>" say "gg wp"`,
+			want: &SayEvent{
+				Player: LogPlayer{Name: "Player", UserID: 2, SteamID: "STEAM_1:0:12345", Team: "CT"},
+				Text:   "gg wp",
+			},
+		},
+		{
+			name: "say_team with quotes and brackets in the name",
+			text: `"[TAG] "Q" <x><9><STEAM_0:1:1><TERRORIST>" say_team "rush "b""`,
+			want: &SayEvent{
+				Player: LogPlayer{Name: `[TAG] "Q" <x>`, UserID: 9, SteamID: "STEAM_0:1:1", Team: "TERRORIST"},
+				Text:   `rush "b"`,
+				Team:   true,
+			},
+		},
+		{
+			name: "console say",
+			text: `"Console<0><Console><Console>" say "map change in 5 minutes"`,
+			want: &SayEvent{
+				Player: LogPlayer{Name: "Console", UserID: 0, SteamID: "Console", Team: "Console"},
+				Text:   "map change in 5 minutes",
+			},
+		},
+		{
+			name: "connected",
+			text: `"Player<2><STEAM_1:0:12345><>" connected, address "192.168.1.5:27005"`,
+			want: &ConnectedEvent{
+				Player:  LogPlayer{Name: "Player", UserID: 2, SteamID: "STEAM_1:0:12345"},
+				Address: "192.168.1.5:27005",
+			},
+		},
+		{
+			name: "bot connected",
+			text: `"Bot Joe<3><BOT><>" connected, address ""`,
+			want: &ConnectedEvent{
+				Player: LogPlayer{Name: "Bot Joe", UserID: 3, SteamID: "BOT"},
+			},
+		},
+		{
+			name: "listen server host connected",
+			text: `"Host<1><STEAM_0:0:42><>" connected, address "loopback"`,
+			want: &ConnectedEvent{
+				Player:  LogPlayer{Name: "Host", UserID: 1, SteamID: "STEAM_0:0:42"},
+				Address: "loopback",
+			},
+		},
+		{
+			name: "ipv6 connected",
+			text: `"Player<4><[U:1:4]><>" connected, address "[2001:db8::1]:27005"`,
+			want: &ConnectedEvent{
+				Player:  LogPlayer{Name: "Player", UserID: 4, SteamID: "[U:1:4]"},
+				Address: "[2001:db8::1]:27005",
+			},
+		},
+		{
+			name: "entered",
+			text: `"Player<2><STEAM_1:0:12345><>" entered the game`,
+			want: &EnteredEvent{
+				Player: LogPlayer{Name: "Player", UserID: 2, SteamID: "STEAM_1:0:12345"},
+			},
+		},
+		{
+			name: "disconnected with reason",
+			text: `"Player<2><STEAM_1:0:12345><CT>" disconnected (reason "Disconnect by user.")`,
+			want: &DisconnectedEvent{
+				Player: LogPlayer{Name: "Player", UserID: 2, SteamID: "STEAM_1:0:12345", Team: "CT"},
+				Reason: "Disconnect by user.",
+			},
+		},
+		{
+			name: "hlds disconnected",
+			text: `"Player<1><STEAM_0:0:1234><CT>" disconnected`,
+			want: &DisconnectedEvent{
+				Player: LogPlayer{Name: "Player", UserID: 1, SteamID: "STEAM_0:0:1234", Team: "CT"},
+			},
+		},
+		{
+			name: "joined team",
+			text: `"Scout<5><[U:1:12345]><Unassigned>" joined team "Red"`,
+			want: &JoinedTeamEvent{
+				Player: LogPlayer{Name: "Scout", UserID: 5, SteamID: "[U:1:12345]", Team: "Unassigned"},
+				Team:   "Red",
+			},
+		},
+		{
+			name: "changed role",
+			text: `"Scout<5><[U:1:12345]><Red>" changed role to "scout"`,
+			want: &ChangedRoleEvent{
+				Player: LogPlayer{Name: "Scout", UserID: 5, SteamID: "[U:1:12345]", Team: "Red"},
+				Role:   "scout",
+			},
+		},
+		{
+			name: "changed name",
+			text: `"Old<2><STEAM_1:0:1><CT>" changed name to "New "Name""`,
+			want: &ChangedNameEvent{
+				Player: LogPlayer{Name: "Old", UserID: 2, SteamID: "STEAM_1:0:1", Team: "CT"},
+				Name:   `New "Name"`,
+			},
+		},
+		{
+			name: "player triggered against",
+			text: `"Medic<7><[U:1:111]><Red>" triggered "medic_death" against "Spy<8><[U:1:222]><Blue>" (healing "410") (ubercharge "0")`,
+			want: &TriggeredEvent{
+				Action:     "medic_death",
+				Player:     &LogPlayer{Name: "Medic", UserID: 7, SteamID: "[U:1:111]", Team: "Red"},
+				Victim:     &LogPlayer{Name: "Spy", UserID: 8, SteamID: "[U:1:222]", Team: "Blue"},
+				Properties: map[string]string{"healing": "410", "ubercharge": "0"},
+			},
+		},
+		{
+			name: "hlds player triggered",
+			text: `"Player<1><STEAM_0:0:1234><TERRORIST>" triggered "Planted_The_Bomb"`,
+			want: &TriggeredEvent{
+				Action: "Planted_The_Bomb",
+				Player: &LogPlayer{Name: "Player", UserID: 1, SteamID: "STEAM_0:0:1234", Team: "TERRORIST"},
+			},
+		},
+		{
+			name: "team triggered",
+			text: `Team "Red" triggered "pointcaptured" (cp "0") (cpname "#Badlands_cap_cp1") (numcappers "2")`,
+			want: &TriggeredEvent{
+				Team:       "Red",
+				Action:     "pointcaptured",
+				Properties: map[string]string{"cp": "0", "cpname": "#Badlands_cap_cp1", "numcappers": "2"},
+			},
+		},
+		{
+			name: "world triggered",
+			text: `World triggered "Round_Start"`,
+			want: &TriggeredEvent{Action: "Round_Start"},
+		},
+		{
+			name: "loading map",
+			text: `Loading map "de_dust2"`,
+			want: &MapLoadingEvent{Map: "de_dust2"},
+		},
+		{
+			name: "started map",
+			text: `Started map "de_dust2" (CRC "1934781425")`,
+			want: &MapStartedEvent{Map: "de_dust2", CRC: "1934781425"},
+		},
+		{
+			name: "hlds rcon",
+			text: `Rcon: "rcon 1234567890 "secret" status" from "192.168.1.10:27005"`,
+			want: &RCONEvent{Command: "status", Address: "192.168.1.10:27005"},
+		},
+		{
+			name: "hlds bad rcon",
+			text: `Bad Rcon: "rcon 1234567890 "wrong" status" from "192.168.1.10:27005"`,
+			want: &RCONEvent{Command: "status", Address: "192.168.1.10:27005", BadPassword: true},
+		},
+		{
+			name: "source rcon",
+			text: `rcon from "127.0.0.1:54321": command "sv_cheats "1""`,
+			want: &RCONEvent{Command: `sv_cheats "1"`, Address: "127.0.0.1:54321"},
+		},
+		{
+			name: "source rcon bad password",
+			text: `rcon from "10.0.0.1:50000": Bad Password`,
+			want: &RCONEvent{Address: "10.0.0.1:50000", BadPassword: true},
+		},
+		{
+			name: "csgo switched team",
+			text: `"Player<2><STEAM_1:0:12345>" switched from team <Unassigned> to <CT>`,
+			want: &GenericEvent{Text: `"Player<2><STEAM_1:0:12345>" switched from team <Unassigned> to <CT>`},
+		},
+		{
+			name: "server cvar",
+			text: `server_cvar: "mp_friendlyfire" "0"`,
+			want: &GenericEvent{Text: `server_cvar: "mp_friendlyfire" "0"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseLogEvent(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package steam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	hLogPacket       = 'R'
+	hSecretLogPacket = 'S'
+)
+
+// Layout of the timestamp prefixed to every log line, as in
+// "L 10/17/2026 - 12:00:00: ".
+const logTimeLayout = "01/02/2006 - 15:04:05"
+
+// LogLine is a line of a server log.
+type LogLine struct {
+	// Address of the server which sent the line.
+	Addr net.Addr
+
+	Time time.Time
+	Text string
+}
+
+type logPacket struct {
+	Secret bool
+	Body   string
+}
+
+// unmarshalBinary decodes a log packet. The secret, if any, is left in
+// front of the line.
+func (p *logPacket) unmarshalBinary(data []byte) error {
+	if len(data) < 5 || !bytes.Equal(data[:4], requestPrefix) {
+		return errBadData
+	}
+	switch data[4] {
+	case hLogPacket:
+	case hSecretLogPacket:
+		p.Secret = true
+	default:
+		return errBadData
+	}
+	p.Body = strings.TrimRight(string(data[5:]), "\x00\r\n")
+	return nil
+}
+
+// parseLogLine splits a line into its timestamp and text.
+func parseLogLine(line string, loc *time.Location) (time.Time, string, error) {
+	if !strings.HasPrefix(line, "L ") {
+		return time.Time{}, "", errBadData
+	}
+	line = line[2:]
+	if len(line) < len(logTimeLayout)+2 || line[len(logTimeLayout)] != ':' {
+		return time.Time{}, "", errBadData
+	}
+	t, err := time.ParseInLocation(logTimeLayout, line[:len(logTimeLayout)], loc)
+	if err != nil {
+		return time.Time{}, "", errBadData
+	}
+	return t, strings.TrimPrefix(line[len(logTimeLayout)+1:], " "), nil
+}
+
+// LogListenerOptions describes the various log listener options.
+type LogListenerOptions struct {
+	// Value of sv_logsecret on the servers. If set, only lines sent with
+	// this secret are accepted, otherwise only lines sent without a secret.
+	Secret string
+
+	// Time zone of the servers. Default is the local time zone.
+	Location *time.Location
+}
+
+// LogListener receives the logs servers send to addresses added with
+// logaddress_add.
+type LogListener struct {
+	conn     net.PacketConn
+	secret   string
+	location *time.Location
+
+	mu         sync.Mutex
+	registered []logRegistration
+}
+
+type logRegistration struct {
+	server *Server
+	addr   string
+}
+
+// ListenLog listens for logs on the UDP address.
+func ListenLog(addr string, os ...*LogListenerOptions) (*LogListener, error) {
+	l := &LogListener{
+		location: time.Local,
+	}
+	if len(os) > 0 {
+		o := os[0]
+		l.secret = o.Secret
+		if o.Location != nil {
+			l.location = o.Location
+		}
+	}
+	var err error
+	if l.conn, err = net.ListenPacket("udp", addr); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Addr returns the local address of the listener.
+func (l *LogListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Receive waits for the next log line. Packets which are malformed or
+// fail the secret check are dropped.
+func (l *LogListener) Receive() (*LogLine, error) {
+	return l.ReceiveContext(context.Background())
+}
+
+// ReceiveContext is like Receive but stops waiting once ctx is done.
+func (l *LogListener) ReceiveContext(ctx context.Context) (*LogLine, error) {
+	stop := watchContext(ctx, l.conn)
+	defer stop()
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		line, err := l.parse(buf[:n])
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"addr": addr,
+				"err":  err,
+			}).Debug("steam: dropping log packet")
+			continue
+		}
+		line.Addr = addr
+		return line, nil
+	}
+}
+
+func (l *LogListener) parse(data []byte) (*LogLine, error) {
+	var p logPacket
+	if err := p.unmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	body := p.Body
+	if p.Secret != (l.secret != "") {
+		return nil, ErrBadLogSecret
+	}
+	if p.Secret {
+		if !strings.HasPrefix(body, l.secret) {
+			return nil, ErrBadLogSecret
+		}
+		body = body[len(l.secret):]
+	}
+	t, text, err := parseLogLine(body, l.location)
+	if err != nil {
+		return nil, err
+	}
+	return &LogLine{Time: t, Text: text}, nil
+}
+
+// Register asks the server to send its logs to addr, which must reach
+// this listener. The server needs an RCON connection. The address is
+// removed again when the listener is closed.
+func (l *LogListener) Register(s *Server, addr string) error {
+	if _, err := s.Send("logaddress_add " + addr); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.registered = append(l.registered, logRegistration{s, addr})
+	l.mu.Unlock()
+	return nil
+}
+
+// Close removes the listener from the servers it was registered on and
+// stops listening. It returns the first error encountered.
+func (l *LogListener) Close() error {
+	l.mu.Lock()
+	registered := l.registered
+	l.registered = nil
+	l.mu.Unlock()
+	var firstErr error
+	for _, r := range registered {
+		if _, err := r.server.Send("logaddress_del " + r.addr); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := l.conn.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+var ErrBadLogSecret = errors.New("steam: bad log secret")
@@ -0,0 +1,149 @@
+package steam
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogPacketUnmarshalBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want logPacket
+		err  error
+	}{
+		{"plain", "\xFF\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: hello\n\x00", logPacket{Body: "L 10/17/2026 - 12:00:00: hello"}, nil},
+		{"secret", "\xFF\xFF\xFF\xFFSabcL 10/17/2026 - 12:00:00: hello\r\n", logPacket{Secret: true, Body: "abcL 10/17/2026 - 12:00:00: hello"}, nil},
+		{"bad prefix", "\xFF\xFF\xFF\xFERL 10/17/2026 - 12:00:00: hello", logPacket{}, errBadData},
+		{"bad header", "\xFF\xFF\xFF\xFFXL 10/17/2026 - 12:00:00: hello", logPacket{}, errBadData},
+		{"short", "\xFF\xFF\xFF\xFF", logPacket{}, errBadData},
+	}
+	for _, tt := range tests {
+		var p logPacket
+		if err := p.unmarshalBinary([]byte(tt.data)); err != tt.err {
+			t.Fatalf("%v: got error %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.err == nil && p != tt.want {
+			t.Fatalf("%v: got %+v, want %+v", tt.name, p, tt.want)
+		}
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	loc := time.FixedZone("test", 3600)
+	tests := []struct {
+		line string
+		time time.Time
+		text string
+		err  error
+	}{
+		{"L 10/17/2026 - 12:34:56: hello world", time.Date(2026, 10, 17, 12, 34, 56, 0, loc), "hello world", nil},
+		{"L 10/17/2026 - 12:34:56:", time.Time{}, "", errBadData},
+		{"L 10/17/2026 - 12:34:56:x", time.Date(2026, 10, 17, 12, 34, 56, 0, loc), "x", nil},
+		{"X 10/17/2026 - 12:34:56: hello", time.Time{}, "", errBadData},
+		{"L 10/17/2026 - 12:34:56 hello", time.Time{}, "", errBadData},
+		{"L 13/17/2026 - 12:34:56: hello", time.Time{}, "", errBadData},
+		{"L 10/17", time.Time{}, "", errBadData},
+	}
+	for _, tt := range tests {
+		tm, text, err := parseLogLine(tt.line, loc)
+		if err != tt.err {
+			t.Fatalf("%q: got error %v, want %v", tt.line, err, tt.err)
+		}
+		if !tm.Equal(tt.time) || text != tt.text {
+			t.Fatalf("%q: got %v %q, want %v %q", tt.line, tm, text, tt.time, tt.text)
+		}
+	}
+}
+
+func TestLogListenerSecret(t *testing.T) {
+	const line = "L 10/17/2026 - 12:00:00: hello"
+	tests := []struct {
+		name   string
+		secret string
+		data   string
+		err    error
+	}{
+		{"plain without secret", "", "\xFF\xFF\xFF\xFFR" + line, nil},
+		{"secret", "abc", "\xFF\xFF\xFF\xFFSabc" + line, nil},
+		{"plain with secret configured", "abc", "\xFF\xFF\xFF\xFFR" + line, ErrBadLogSecret},
+		{"wrong secret", "abc", "\xFF\xFF\xFF\xFFSabd" + line, ErrBadLogSecret},
+		{"secret without secret configured", "", "\xFF\xFF\xFF\xFFSabc" + line, ErrBadLogSecret},
+	}
+	for _, tt := range tests {
+		l := &LogListener{secret: tt.secret, location: time.UTC}
+		got, err := l.parse([]byte(tt.data))
+		if err != tt.err {
+			t.Fatalf("%v: got error %v, want %v", tt.name, err, tt.err)
+		}
+		if err == nil && got.Text != "hello" {
+			t.Fatalf("%v: got %q, want %q", tt.name, got.Text, "hello")
+		}
+	}
+}
+
+func TestLogListenerReceive(t *testing.T) {
+	l, err := ListenLog("127.0.0.1:0", &LogListenerOptions{Secret: "abc", Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The packet failing the secret check is dropped.
+	conn.Write([]byte("\xFF\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: dropped\n\x00"))
+	conn.Write([]byte("\xFF\xFF\xFF\xFFSabcL 10/17/2026 - 12:00:01: kept\n\x00"))
+	line, err := l.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LogLine{Addr: conn.LocalAddr(), Time: time.Date(2026, 10, 17, 12, 0, 1, 0, time.UTC), Text: "kept"}
+	if line.Addr.String() != want.Addr.String() || !line.Time.Equal(want.Time) || line.Text != want.Text {
+		t.Fatalf("got %+v, want %+v", line, want)
+	}
+}
+
+func TestLogListenerRegister(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	rs := NewRCONServer(RCONHandlerFunc(func(cmd string, _ net.Addr) string {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		return ""
+	}), &RCONServerOptions{Password: "secret"})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rs.Serve(ln)
+	defer rs.Close()
+	s, err := NewRCONClient(ln.Addr().String(), &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l, err := ListenLog("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Register(s, "10.0.0.1:27500"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"logaddress_add 10.0.0.1:27500", "logaddress_del 10.0.0.1:27500"}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("got %q, want %q", cmds, want)
+	}
+}
@@ -0,0 +1,267 @@
+package steam
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MasterServerAddr is the address of the Valve master server for Source
+// and GoldSrc servers.
+const MasterServerAddr = "hl2master.steampowered.com:27011"
+
+const (
+	hMasterQueryRequest  = 0x31
+	hMasterQueryResponse = 0x66
+)
+
+// Seed which starts a query, and marks the end of the results when
+// returned by the master server.
+const masterQuerySeed = "0.0.0.0:0"
+
+// Region of the servers returned by a master server query.
+type Region byte
+
+func (r Region) String() string {
+	return regionStrings[r]
+}
+
+const (
+	RUSEastCoast  Region = 0x00
+	RUSWestCoast  Region = 0x01
+	RSouthAmerica Region = 0x02
+	REurope       Region = 0x03
+	RAsia         Region = 0x04
+	RAustralia    Region = 0x05
+	RMiddleEast   Region = 0x06
+	RAfrica       Region = 0x07
+	RWorld        Region = 0xFF
+)
+
+var regionStrings = map[Region]string{
+	RUSEastCoast:  "US East Coast",
+	RUSWestCoast:  "US West Coast",
+	RSouthAmerica: "South America",
+	REurope:       "Europe",
+	RAsia:         "Asia",
+	RAustralia:    "Australia",
+	RMiddleEast:   "Middle East",
+	RAfrica:       "Africa",
+	RWorld:        "World",
+}
+
+// Filter restricts the servers returned by a master server query. It uses
+// the master server syntax, e.g. `\appid\440\map\ctf_2fort`. The zero value
+// matches every server.
+type Filter string
+
+// Add returns the filter extended with the given condition.
+func (f Filter) Add(key, value string) Filter {
+	return f + Filter(`\`+key+`\`+value)
+}
+
+// AppID returns the filter restricted to servers running the given app.
+func (f Filter) AppID(id int) Filter {
+	return f.Add("appid", strconv.Itoa(id))
+}
+
+// GameDir returns the filter restricted to servers running the given mod
+// directory.
+func (f Filter) GameDir(dir string) Filter {
+	return f.Add("gamedir", dir)
+}
+
+// Map returns the filter restricted to servers running the given map.
+func (f Filter) Map(m string) Filter {
+	return f.Add("map", m)
+}
+
+type masterQueryRequest struct {
+	Region Region
+	Seed   string
+	Filter Filter
+}
+
+func (r masterQueryRequest) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writeByte(buf, hMasterQueryRequest)
+	writeByte(buf, byte(r.Region))
+	writeString(buf, r.Seed)
+	writeString(buf, string(r.Filter))
+	return buf.Bytes(), nil
+}
+
+type masterQueryResponse struct {
+	Addrs []string
+}
+
+func (r *masterQueryResponse) unmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	header := readByte(buf)
+	if header != hMasterQueryResponse {
+		panic(errBadData)
+	}
+	// Skip the line feed following the header.
+	readByte(buf)
+	if buf.Len()%6 != 0 {
+		panic(errBadData)
+	}
+	for buf.Len() > 0 {
+		ip := net.IP(readBytes(buf, 4))
+		port := binary.BigEndian.Uint16(readBytes(buf, 2))
+		r.Addrs = append(r.Addrs, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return nil
+}
+
+// MasterQuery iterates over the servers returned by a master server. The
+// master server sends them in batches, which are fetched as needed.
+//
+//	q, err := steam.QueryMaster(steam.MasterServerAddr, steam.RWorld, steam.Filter("").AppID(440))
+//	if err != nil {
+//		...
+//	}
+//	defer q.Close()
+//	for q.Next() {
+//		fmt.Println(q.Addr())
+//	}
+//	if err := q.Err(); err != nil {
+//		...
+//	}
+type MasterQuery struct {
+	usock *udpSocket
+
+	region Region
+	filter Filter
+	seed   string
+	retry  *RetryPolicy
+
+	batch []string
+	addr  string
+	done  bool
+	err   error
+}
+
+// QueryMaster starts a query for the servers in the given region matching
+// the filter. Only the Dial, DialTimeout, QueryTimeout and Retry options
+// are used.
+func QueryMaster(addr string, region Region, filter Filter, os ...*ConnectOptions) (*MasterQuery, error) {
+	return QueryMasterContext(context.Background(), addr, region, filter, os...)
+}
+
+// QueryMasterContext is like QueryMaster but gives up on opening the socket
+// once ctx is done.
+func QueryMasterContext(ctx context.Context, addr string, region Region, filter Filter, os ...*ConnectOptions) (*MasterQuery, error) {
+	var (
+		dial        DialFn
+		dialTimeout time.Duration
+		timeout     = defaultQueryTimeout
+		policy      *RetryPolicy
+	)
+	if len(os) > 0 {
+		o := os[0]
+		dial = o.Dial
+		dialTimeout = o.DialTimeout
+		if o.QueryTimeout > 0 {
+			timeout = o.QueryTimeout
+		}
+		if o.Retry != nil {
+			r := *o.Retry
+			policy = &r
+		}
+	}
+	usock, err := newUDPSocket(ctx, newDialContext(dial, dialTimeout), addr, SPFAuto, timeout)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: could not open udp socket")
+		return nil, err
+	}
+	return &MasterQuery{
+		usock:  usock,
+		region: region,
+		filter: filter,
+		seed:   masterQuerySeed,
+		retry:  policy,
+	}, nil
+}
+
+// Next advances to the next server, fetching another batch from the master
+// server if needed. It returns false when there are no more servers or an
+// error occurred.
+func (q *MasterQuery) Next() bool {
+	return q.NextContext(context.Background())
+}
+
+// NextContext is like Next but stops waiting for the master server once
+// ctx is done, in which case Err returns the error of ctx.
+func (q *MasterQuery) NextContext(ctx context.Context) bool {
+	for len(q.batch) == 0 {
+		if q.done || q.err != nil {
+			return false
+		}
+		q.err = retry(ctx, q.retry, func() error {
+			return q.fetch(ctx)
+		})
+	}
+	q.addr, q.batch = q.batch[0], q.batch[1:]
+	return true
+}
+
+// Addr returns the address of the current server.
+func (q *MasterQuery) Addr() string {
+	return q.addr
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (q *MasterQuery) Err() error {
+	return q.err
+}
+
+// Close releases the resources associated with this query.
+func (q *MasterQuery) Close() {
+	q.usock.close()
+}
+
+func (q *MasterQuery) fetch(ctx context.Context) error {
+	req, _ := masterQueryRequest{q.region, q.seed, q.filter}.marshalBinary()
+	if err := q.usock.send(req); err != nil {
+		return err
+	}
+	data, err := q.usock.receive(ctx, hMasterQueryResponse)
+	if err != nil {
+		return err
+	}
+	var res masterQueryResponse
+	if err := res.unmarshalBinary(data); err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"seed":  q.seed,
+		"count": len(res.Addrs),
+	}).Debug("steam: received master server batch")
+	if len(res.Addrs) == 0 {
+		q.done = true
+		return nil
+	}
+	for _, addr := range res.Addrs {
+		if addr == masterQuerySeed {
+			q.done = true
+			break
+		}
+		q.batch = append(q.batch, addr)
+	}
+	// The last server of a batch is the seed for the next one.
+	q.seed = res.Addrs[len(res.Addrs)-1]
+	return nil
+}
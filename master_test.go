@@ -0,0 +1,87 @@
+package steam
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// masterBatch builds a master server response listing addrs.
+func masterBatch(t *testing.T, addrs ...string) []byte {
+	buf := bytes.NewBuffer([]byte{0xFF, 0xFF, 0xFF, 0xFF, hMasterQueryResponse, '\n'})
+	for _, addr := range addrs {
+		ua, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(ua.IP.To4())
+		buf.Write([]byte{byte(ua.Port >> 8), byte(ua.Port)})
+	}
+	return buf.Bytes()
+}
+
+func TestQueryMaster(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	batches := map[string][]byte{
+		masterQuerySeed: masterBatch(t, "1.2.3.4:27015", "5.6.7.8:27016"),
+		"5.6.7.8:27016": masterBatch(t, "9.9.9.9:27017", masterQuerySeed),
+	}
+	requests := make(chan []byte, 10)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			requests <- req
+			// Header, region, then the seed and the filter, NUL terminated.
+			fields := bytes.Split(req[2:], []byte{0})
+			if batch, ok := batches[string(fields[0])]; ok {
+				conn.WriteTo(batch, addr)
+			}
+		}
+	}()
+
+	var dialed string
+	q, err := QueryMaster(MasterServerAddr, REurope, Filter("").AppID(440).Map("ctf_2fort"), &ConnectOptions{
+		Dial: func(network, address string) (net.Conn, error) {
+			dialed = address
+			return net.Dial(network, conn.LocalAddr().String())
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	var got []string
+	for q.Next() {
+		got = append(got, q.Addr())
+	}
+	if err := q.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if dialed != MasterServerAddr {
+		t.Fatalf("dialed %v, want %v", dialed, MasterServerAddr)
+	}
+	if want := []string{"1.2.3.4:27015", "5.6.7.8:27016", "9.9.9.9:27017"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// Both requests were answered, so they have been recorded.
+	reqs := [][]byte{<-requests, <-requests}
+	filter := `\appid\440\map\ctf_2fort` + "\x00"
+	want := [][]byte{
+		[]byte("\x31\x03" + masterQuerySeed + "\x00" + filter),
+		// The last server of the first batch seeds the second request.
+		[]byte("\x31\x035.6.7.8:27016\x00" + filter),
+	}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Fatalf("got requests %q, want %q", reqs, want)
+	}
+}
@@ -0,0 +1,269 @@
+package steam
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	singlePacketHeader = -1
+	multiPacketHeader  = -2
+
+	// Bit set in the ID of a split response whose payload is bzip2
+	// compressed.
+	multiPacketCompressed = 0x80000000
+
+	// Largest decompressed size accepted for a compressed response, far
+	// above what 255 fragments of uncompressed data could hold.
+	maxMultiPacketDecompressedSize = 1 << 20
+)
+
+// SplitPacketFormat is the layout of the header servers put in front of
+// each fragment of a split response.
+type SplitPacketFormat int
+
+func (f SplitPacketFormat) String() string {
+	return splitPacketFormatStrings[f]
+}
+
+const (
+	// SPFAuto detects the format from the first fragment of a response.
+	SPFAuto SplitPacketFormat = iota
+	// SPFSource is used by Source engine servers.
+	SPFSource
+	// SPFGoldSrc is used by Half-Life 1 engine servers.
+	SPFGoldSrc
+)
+
+var splitPacketFormatStrings = map[SplitPacketFormat]string{
+	SPFAuto:    "Auto",
+	SPFSource:  "Source",
+	SPFGoldSrc: "GoldSrc",
+}
+
+// detectSplitPacketFormat guesses the format of a split packet. Only the
+// first fragment of a response can be told apart reliably: a GoldSrc
+// header is one byte shorter, so the payload's single packet header starts
+// where the Source packet number would be, and no packet number can be
+// 0xFF. SPFAuto is returned if the fragment gives no clue.
+func detectSplitPacketFormat(data []byte) SplitPacketFormat {
+	if len(data) >= 13 && data[8]&0xF0 == 0 && bytes.Equal(data[9:13], requestPrefix) {
+		return SPFGoldSrc
+	}
+	if len(data) >= 16 && data[9] == 0 {
+		if bytes.Equal(data[12:16], requestPrefix) {
+			return SPFSource
+		}
+		if data[7]&0x80 != 0 && len(data) >= 23 && bytes.Equal(data[20:23], []byte("BZh")) {
+			return SPFSource
+		}
+	}
+	return SPFAuto
+}
+
+// multiPacket is a single fragment of a split response.
+type multiPacket struct {
+	Format SplitPacketFormat
+
+	ID     int32
+	Total  int
+	Number int
+
+	// Only present in the first fragment of a compressed response.
+	DecompressedSize int
+	CRC32            uint32
+
+	Payload []byte
+}
+
+func (p *multiPacket) compressed() bool {
+	return uint32(p.ID)&multiPacketCompressed != 0
+}
+
+func (p *multiPacket) unmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	buf := bytes.NewBuffer(data)
+	if readLong(buf) != multiPacketHeader {
+		panic(errBadData)
+	}
+	p.ID = readLong(buf)
+	if p.Format == SPFGoldSrc {
+		// The packet number and total count share a byte and there is no
+		// size field.
+		b := readByte(buf)
+		p.Total = int(b & 0x0F)
+		p.Number = int(b >> 4)
+	} else {
+		p.Total = toInt(readByte(buf))
+		p.Number = toInt(readByte(buf))
+		// Maximum packet size of the server, which reassembly does not
+		// need.
+		readUShort(buf)
+	}
+	if p.Total == 0 || p.Number >= p.Total {
+		panic(errBadData)
+	}
+	if p.Format != SPFGoldSrc && p.compressed() && p.Number == 0 {
+		p.DecompressedSize = toInt(readLong(buf))
+		p.CRC32 = readULong(buf)
+		if p.DecompressedSize < 0 || p.DecompressedSize > maxMultiPacketDecompressedSize {
+			panic(errBadData)
+		}
+	}
+	p.Payload = buf.Bytes()
+	return nil
+}
+
+// multiPacketResponse collects the fragments of one split response.
+type multiPacketResponse struct {
+	packets  []*multiPacket
+	received int
+}
+
+// add stores the fragment and reports whether the response is complete.
+// Fragments may arrive in any order; duplicates are ignored.
+func (r *multiPacketResponse) add(p *multiPacket) (bool, error) {
+	if r.packets == nil {
+		r.packets = make([]*multiPacket, p.Total)
+	}
+	if p.Total != len(r.packets) {
+		return false, errBadData
+	}
+	if r.packets[p.Number] == nil {
+		r.packets[p.Number] = p
+		r.received++
+	}
+	return r.received == len(r.packets), nil
+}
+
+// assemble joins the fragments, decompressing them if needed. The
+// returned payload still carries the single packet header.
+func (r *multiPacketResponse) assemble() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, p := range r.packets {
+		buf.Write(p.Payload)
+	}
+	first := r.packets[0]
+	if first.Format == SPFGoldSrc || !first.compressed() {
+		return buf.Bytes(), nil
+	}
+	// Read one byte more than announced, so a payload which decompresses
+	// to more is caught without decompressing all of it.
+	data, err := ioutil.ReadAll(io.LimitReader(bzip2.NewReader(&buf), int64(first.DecompressedSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != first.DecompressedSize {
+		return nil, errBadData
+	}
+	if crc32.ChecksumIEEE(data) != first.CRC32 {
+		return nil, errBadChecksum
+	}
+	return data, nil
+}
+
+// multiPacketAssembler reassembles split responses keyed by their ID.
+type multiPacketAssembler struct {
+	// Format of the fragments. If set to SPFAuto, fragments are held back
+	// until one of them reveals the format.
+	format SplitPacketFormat
+
+	pending   [][]byte
+	responses map[int32]*multiPacketResponse
+}
+
+// add feeds a raw split packet to the assembler. It returns the complete
+// payload once every fragment of the response has been seen, and nil
+// otherwise.
+func (a *multiPacketAssembler) add(data []byte) ([]byte, error) {
+	if a.format != SPFAuto {
+		return a.addPacket(data)
+	}
+	if a.format = detectSplitPacketFormat(data); a.format == SPFAuto {
+		a.pending = append(a.pending, data)
+		return nil, nil
+	}
+	log.WithFields(logrus.Fields{
+		"format": a.format,
+	}).Debug("steam: detected split packet format")
+	pending := a.pending
+	a.pending = nil
+	for _, data := range pending {
+		if _, err := a.addPacket(data); err != nil {
+			return nil, err
+		}
+	}
+	return a.addPacket(data)
+}
+
+func (a *multiPacketAssembler) addPacket(data []byte) ([]byte, error) {
+	p := multiPacket{Format: a.format}
+	if err := p.unmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	log.WithFields(logrus.Fields{
+		"id":     p.ID,
+		"number": p.Number,
+		"total":  p.Total,
+	}).Debug("steam: received split packet")
+	if a.responses == nil {
+		a.responses = make(map[int32]*multiPacketResponse)
+	}
+	r, ok := a.responses[p.ID]
+	if !ok {
+		r = new(multiPacketResponse)
+		a.responses[p.ID] = r
+	}
+	done, err := r.add(&p)
+	if err != nil || !done {
+		return nil, err
+	}
+	delete(a.responses, p.ID)
+	return r.assemble()
+}
+
+// Size of the Source split packet header.
+const multiPacketHeaderSize = 12
+
+// splitResponse splits a response into Source formatted fragments of at
+// most size bytes each. A response that fits is returned as it is.
+func splitResponse(id int32, data []byte, size int) ([][]byte, error) {
+	if len(data) <= size {
+		return [][]byte{data}, nil
+	}
+	chunk := size - multiPacketHeaderSize
+	if chunk <= 0 {
+		return nil, errResponseTooLarge
+	}
+	total := (len(data) + chunk - 1) / chunk
+	if total > 255 {
+		return nil, errResponseTooLarge
+	}
+	// The compression bit is never set as fragments are sent uncompressed.
+	id = int32(uint32(id) &^ multiPacketCompressed)
+	packets := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		buf := new(bytes.Buffer)
+		writeLong(buf, multiPacketHeader)
+		writeLong(buf, id)
+		writeByte(buf, byte(total))
+		writeByte(buf, byte(i))
+		writeUShort(buf, uint16(size))
+		buf.Write(data[i*chunk : end])
+		packets = append(packets, buf.Bytes())
+	}
+	return packets, nil
+}
@@ -0,0 +1,239 @@
+package steam
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"testing"
+)
+
+// sourceFragment builds a fragment with the Source split packet header.
+// The first fragment of a compressed response carries size and crc.
+func sourceFragment(id int32, total, number int, payload []byte, size int, crc uint32) []byte {
+	buf := new(bytes.Buffer)
+	writeLong(buf, multiPacketHeader)
+	writeLong(buf, id)
+	writeByte(buf, byte(total))
+	writeByte(buf, byte(number))
+	writeUShort(buf, 1248)
+	if uint32(id)&multiPacketCompressed != 0 && number == 0 {
+		writeLong(buf, int32(size))
+		writeULong(buf, crc)
+	}
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// goldSrcFragment builds a fragment with the GoldSrc split packet header.
+func goldSrcFragment(id int32, total, number int, payload []byte) []byte {
+	buf := new(bytes.Buffer)
+	writeLong(buf, multiPacketHeader)
+	writeLong(buf, id)
+	writeByte(buf, byte(number<<4|total))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestMultiPacketAssembler(t *testing.T) {
+	payload := append([]byte{0xFF, 0xFF, 0xFF, 0xFF, hRulesResponse}, bytes.Repeat([]byte("steam "), 16)...)
+	head, tail := payload[:40], payload[40:]
+
+	// bzip2 -9 of payload.
+	compressed, _ := hex.DecodeString("425a68393141592653594c618957000032d580c0004000020022020c000000a00031064c4054a68326782bc181617724c0c95f1772453850904c618957")
+	cid := int32(-0x7FFFFFFF) // 0x80000001
+	crc := crc32.ChecksumIEEE(payload)
+
+	tests := []struct {
+		name      string
+		format    SplitPacketFormat
+		fragments [][]byte
+		err       error
+	}{
+		{
+			name:   "source",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 0, head, 0, 0),
+				sourceFragment(1, 2, 1, tail, 0, 0),
+			},
+		},
+		{
+			name:   "source out of order",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 1, tail, 0, 0),
+				sourceFragment(1, 2, 0, head, 0, 0),
+			},
+		},
+		{
+			name:   "source detected",
+			format: SPFAuto,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 1, tail, 0, 0),
+				sourceFragment(1, 2, 0, head, 0, 0),
+			},
+		},
+		{
+			name:   "source duplicate",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 0, head, 0, 0),
+				sourceFragment(1, 2, 0, head, 0, 0),
+				sourceFragment(1, 2, 1, tail, 0, 0),
+			},
+		},
+		{
+			name:   "goldsrc",
+			format: SPFGoldSrc,
+			fragments: [][]byte{
+				goldSrcFragment(7, 2, 0, head),
+				goldSrcFragment(7, 2, 1, tail),
+			},
+		},
+		{
+			name:   "goldsrc detected out of order",
+			format: SPFAuto,
+			fragments: [][]byte{
+				goldSrcFragment(7, 2, 1, tail),
+				goldSrcFragment(7, 2, 0, head),
+			},
+		},
+		{
+			name:   "compressed",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(cid, 2, 0, compressed[:30], len(payload), crc),
+				sourceFragment(cid, 2, 1, compressed[30:], 0, 0),
+			},
+		},
+		{
+			name:   "compressed detected out of order",
+			format: SPFAuto,
+			fragments: [][]byte{
+				sourceFragment(cid, 2, 1, compressed[30:], 0, 0),
+				sourceFragment(cid, 2, 0, compressed[:30], len(payload), crc),
+			},
+		},
+		{
+			name:   "compressed bad crc",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(cid, 2, 0, compressed[:30], len(payload), crc+1),
+				sourceFragment(cid, 2, 1, compressed[30:], 0, 0),
+			},
+			err: errBadChecksum,
+		},
+		{
+			name:   "compressed larger than announced",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(cid, 1, 0, compressed, 16, crc),
+			},
+			err: errBadData,
+		},
+		{
+			name:   "compressed negative size",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(cid, 1, 0, compressed, -1, crc),
+			},
+			err: errBadData,
+		},
+		{
+			name:   "compressed size too large",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(cid, 1, 0, compressed, maxMultiPacketDecompressedSize+1, crc),
+			},
+			err: errBadData,
+		},
+		{
+			name:   "truncated fragment",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 0, head, 0, 0)[:9],
+			},
+			err: errNotEnoughDataInResponse,
+		},
+		{
+			name:   "number out of range",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 2, tail, 0, 0),
+			},
+			err: errBadData,
+		},
+		{
+			name:   "total mismatch",
+			format: SPFSource,
+			fragments: [][]byte{
+				sourceFragment(1, 2, 0, head, 0, 0),
+				sourceFragment(1, 3, 1, tail, 0, 0),
+			},
+			err: errBadData,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := multiPacketAssembler{format: tt.format}
+			var (
+				data []byte
+				err  error
+			)
+			for i, f := range tt.fragments {
+				if data != nil {
+					t.Fatalf("response complete before fragment %v", i)
+				}
+				if data, err = a.add(f); err != nil {
+					break
+				}
+			}
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if !bytes.Equal(data, payload) {
+				t.Fatalf("got payload %q, want %q", data, payload)
+			}
+		})
+	}
+}
+
+func TestSplitResponse(t *testing.T) {
+	data := append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, bytes.Repeat([]byte{'x'}, 100)...)
+	packets, err := splitResponse(5, data, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 4 {
+		t.Fatalf("got %v fragments, want 4", len(packets))
+	}
+	a := multiPacketAssembler{format: SPFAuto}
+	var got []byte
+	for i := len(packets) - 1; i >= 0; i-- {
+		if len(packets[i]) > 40 {
+			t.Fatalf("fragment %v is %v bytes", i, len(packets[i]))
+		}
+		if int32(binary.LittleEndian.Uint32(packets[i][4:])) != 5 {
+			t.Fatalf("fragment %v has the wrong id", i)
+		}
+		if got, err = a.add(packets[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %q, want %q", got, data)
+	}
+}
+
+func TestSplitResponseTooLarge(t *testing.T) {
+	data := bytes.Repeat([]byte{'x'}, 300)
+	for _, size := range []int{0, multiPacketHeaderSize, multiPacketHeaderSize + 1} {
+		if _, err := splitResponse(1, data, size); err != errResponseTooLarge {
+			t.Errorf("size %v: got %v, want %v", size, err, errResponseTooLarge)
+		}
+	}
+}
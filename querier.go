@@ -0,0 +1,464 @@
+package steam
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// QueryKind selects the queries Querier.Query runs on each address.
+type QueryKind int
+
+const (
+	QKInfo QueryKind = 1 << iota
+	QKPlayers
+	QKRules
+)
+
+// QuerierOptions describes the various querier options.
+type QuerierOptions struct {
+	// Local address of the socket. Default is any free port.
+	LocalAddr string
+
+	// Number of addresses Query works on at once. Default is 64.
+	Workers int
+
+	// Time allowed for all the queries to a single address. Default is
+	// 1s.
+	Timeout time.Duration
+
+	// Format of split responses. Default will detect it per server.
+	SplitPacketFormat SplitPacketFormat
+}
+
+// Querier queries many servers over a single unconnected UDP socket.
+// Replies are matched to the queries by their source address and header.
+// Queries to the same address are run one at a time.
+type Querier struct {
+	// Packets dropped by the reader, first for 64-bit alignment.
+	dropped uint64
+
+	conn    net.PacketConn
+	workers int
+	timeout time.Duration
+	format  SplitPacketFormat
+
+	mu    sync.Mutex
+	peers map[string]*querierPeer
+	// Time of the last sweep of the idle peers.
+	swept time.Time
+
+	// Closed once the reader stopped, err holds the reason.
+	done chan struct{}
+	err  error
+}
+
+// querierPeer is the state kept for a server.
+type querierPeer struct {
+	addr *net.UDPAddr
+
+	// Held by the query in flight, which owns the following fields.
+	busy          chan struct{}
+	infoChallenge int
+	appID         int
+
+	// Guarded by the querier. The reply fields are set while a reply is
+	// expected.
+	refs      int
+	lastUsed  time.Time
+	format    SplitPacketFormat
+	reply     chan querierReply
+	headers   []byte
+	assembler multiPacketAssembler
+}
+
+type querierReply struct {
+	data []byte
+	err  error
+}
+
+// QueryResult holds the responses of an address passed to Query. Only
+// the responses of the requested kinds are set.
+type QueryResult struct {
+	Addr string
+
+	Info    *InfoResponse
+	Players *PlayersInfoResponse
+	Rules   *RulesResponse
+
+	// First error encountered, after which the remaining queries were
+	// skipped.
+	Err error
+}
+
+const (
+	defaultQuerierWorkers = 64
+	querierMaxPacketSize  = 1500
+
+	// Time the state of a server is kept once its queries are over, so
+	// that later queries can reuse its challenge.
+	querierPeerTTL = time.Minute
+)
+
+// NewQuerier opens the socket used for the queries.
+func NewQuerier(os ...*QuerierOptions) (*Querier, error) {
+	q := &Querier{
+		workers: defaultQuerierWorkers,
+		timeout: defaultQueryTimeout,
+		peers:   make(map[string]*querierPeer),
+		done:    make(chan struct{}),
+	}
+	var laddr string
+	if len(os) > 0 {
+		o := os[0]
+		laddr = o.LocalAddr
+		if o.Workers > 0 {
+			q.workers = o.Workers
+		}
+		if o.Timeout > 0 {
+			q.timeout = o.Timeout
+		}
+		q.format = o.SplitPacketFormat
+	}
+	var err error
+	if q.conn, err = net.ListenPacket("udp", laddr); err != nil {
+		return nil, err
+	}
+	go q.readLoop()
+	return q, nil
+}
+
+// LocalAddr returns the local address of the socket.
+func (q *Querier) LocalAddr() net.Addr {
+	return q.conn.LocalAddr()
+}
+
+// DroppedPackets returns the number of packets which were dropped as they
+// did not answer a query in flight.
+func (q *Querier) DroppedPackets() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Close closes the socket. Queries in flight fail.
+func (q *Querier) Close() error {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = errQuerierClosed
+	}
+	q.mu.Unlock()
+	return q.conn.Close()
+}
+
+// Query runs the queries of the given kinds on each address, with a
+// bounded number of workers. One result per address is sent on the
+// returned channel, which is closed once all are done. The channel must
+// be drained.
+func (q *Querier) Query(ctx context.Context, addrs []string, kind QueryKind) <-chan *QueryResult {
+	results := make(chan *QueryResult, q.workers)
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers && i < len(addrs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addr := range jobs {
+				results <- q.query(ctx, addr, kind)
+			}
+		}()
+	}
+	go func() {
+		for _, addr := range addrs {
+			jobs <- addr
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func (q *Querier) query(ctx context.Context, addr string, kind QueryKind) *QueryResult {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	r := &QueryResult{Addr: addr}
+	if kind&QKInfo != 0 {
+		if r.Info, r.Err = q.info(ctx, addr); r.Err != nil {
+			return r
+		}
+	}
+	if kind&QKPlayers != 0 {
+		if r.Players, r.Err = q.playersInfo(ctx, addr); r.Err != nil {
+			return r
+		}
+	}
+	if kind&QKRules != 0 {
+		r.Rules, r.Err = q.rules(ctx, addr)
+	}
+	return r
+}
+
+// Info retrieves information of the server at addr.
+func (q *Querier) Info(ctx context.Context, addr string) (*InfoResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return q.info(ctx, addr)
+}
+
+// PlayersInfo retrieves the players of the server at addr. The fields of
+// The Ship are decoded if Info identified the game, or if the response
+// has room for them.
+func (q *Querier) PlayersInfo(ctx context.Context, addr string) (*PlayersInfoResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return q.playersInfo(ctx, addr)
+}
+
+// Rules retrieves the public cvars of the server at addr.
+func (q *Querier) Rules(ctx context.Context, addr string) (*RulesResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+	return q.rules(ctx, addr)
+}
+
+func (q *Querier) info(ctx context.Context, addr string) (*InfoResponse, error) {
+	p, release, err := q.acquire(ctx, addr)
+	if err != nil {
+		return nil, newOpError(OpInfo, addr, err, nil)
+	}
+	defer release()
+	challenge := p.infoChallenge
+	data, err := q.challengeQuery(ctx, p, func(challenge int) []byte {
+		req, _ := infoRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hInfoResponse, hInfoObsoleteResponse)
+	if err != nil {
+		return nil, newOpError(OpInfo, addr, err, nil)
+	}
+	var res InfoResponse
+	if err := res.unmarshalBinary(data); err != nil {
+		return nil, newOpError(OpInfo, addr, err, data)
+	}
+	p.infoChallenge = challenge
+	p.appID = res.ID
+	res.RemoteAddr = p.addr
+	return &res, nil
+}
+
+func (q *Querier) playersInfo(ctx context.Context, addr string) (*PlayersInfoResponse, error) {
+	p, release, err := q.acquire(ctx, addr)
+	if err != nil {
+		return nil, newOpError(OpPlayers, addr, err, nil)
+	}
+	defer release()
+	var challenge int
+	data, err := q.challengeQuery(ctx, p, func(challenge int) []byte {
+		req, _ := playersInfoRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hPlayersInfoResponse)
+	if err != nil {
+		return nil, newOpError(OpPlayers, addr, err, nil)
+	}
+	var res PlayersInfoResponse
+	if err := res.unmarshalBinary(data, p.appID); err != nil {
+		return nil, newOpError(OpPlayers, addr, err, data)
+	}
+	res.RemoteAddr = p.addr
+	return &res, nil
+}
+
+func (q *Querier) rules(ctx context.Context, addr string) (*RulesResponse, error) {
+	p, release, err := q.acquire(ctx, addr)
+	if err != nil {
+		return nil, newOpError(OpRules, addr, err, nil)
+	}
+	defer release()
+	challenge := -1
+	data, err := q.challengeQuery(ctx, p, func(challenge int) []byte {
+		req, _ := rulesRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hRulesResponse)
+	if err != nil {
+		return nil, newOpError(OpRules, addr, err, nil)
+	}
+	var res RulesResponse
+	if err := res.unmarshalBinary(data); err != nil {
+		return nil, newOpError(OpRules, addr, err, data)
+	}
+	res.RemoteAddr = p.addr
+	return &res, nil
+}
+
+// acquire returns the state of the server at addr, once the queries to it
+// in flight are over. The state may be used until release is called.
+func (q *Querier) acquire(ctx context.Context, addr string) (_ *querierPeer, release func(), _ error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := ua.String()
+	q.mu.Lock()
+	q.sweep()
+	p := q.peers[key]
+	if p == nil {
+		p = &querierPeer{
+			addr:   ua,
+			busy:   make(chan struct{}, 1),
+			format: q.format,
+		}
+		q.peers[key] = p
+	}
+	p.refs++
+	q.mu.Unlock()
+	unref := func() {
+		q.mu.Lock()
+		p.refs--
+		p.lastUsed = time.Now()
+		q.mu.Unlock()
+	}
+	select {
+	case p.busy <- struct{}{}:
+	case <-ctx.Done():
+		unref()
+		return nil, nil, ctx.Err()
+	}
+	return p, func() {
+		<-p.busy
+		unref()
+	}, nil
+}
+
+// sweep forgets the servers which were not queried for querierPeerTTL. It
+// runs at most once per TTL and must be called with mu held.
+func (q *Querier) sweep() {
+	now := time.Now()
+	if now.Sub(q.swept) < querierPeerTTL {
+		return
+	}
+	q.swept = now
+	for key, p := range q.peers {
+		if p.refs == 0 && now.Sub(p.lastUsed) >= querierPeerTTL {
+			delete(q.peers, key)
+		}
+	}
+}
+
+func (q *Querier) challengeQuery(ctx context.Context, p *querierPeer, newReq func(challenge int) []byte, challenge *int, headers ...byte) ([]byte, error) {
+	return challengeExchange(newReq, challenge, headers, func(req, headers []byte) ([]byte, error) {
+		return q.exchange(ctx, p, req, headers)
+	})
+}
+
+// exchange sends req to the server and waits for the reply starting with
+// one of the headers.
+func (q *Querier) exchange(ctx context.Context, p *querierPeer, req []byte, headers []byte) ([]byte, error) {
+	reply := make(chan querierReply, 1)
+	q.mu.Lock()
+	p.reply = reply
+	p.headers = headers
+	p.assembler = multiPacketAssembler{format: p.format}
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		p.reply = nil
+		p.headers = nil
+		q.mu.Unlock()
+	}()
+	if _, err := q.conn.WriteTo(req, p.addr); err != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.err != nil {
+			return nil, q.err
+		}
+		return nil, err
+	}
+	select {
+	case r := <-reply:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.done:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return nil, q.err
+	}
+}
+
+func (q *Querier) readLoop() {
+	buf := make([]byte, querierMaxPacketSize)
+	for {
+		n, addr, err := q.conn.ReadFrom(buf)
+		if err != nil {
+			q.mu.Lock()
+			if q.err == nil {
+				q.err = err
+			}
+			q.mu.Unlock()
+			close(q.done)
+			return
+		}
+		data := make([]byte, n)
+		copy(data, buf)
+		q.handle(data, addr)
+	}
+}
+
+// handle passes a packet to the query in flight to its source address.
+func (q *Querier) handle(data []byte, addr net.Addr) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := q.peers[addr.String()]
+	if p == nil || p.reply == nil || len(data) < 5 {
+		q.drop(data, addr, errBadData)
+		return
+	}
+	switch int32(binary.LittleEndian.Uint32(data)) {
+	case singlePacketHeader:
+	case multiPacketHeader:
+		assembled, err := p.assembler.add(data)
+		if err != nil {
+			q.deliver(p, nil, &packetError{err, data})
+			return
+		}
+		if assembled == nil {
+			return
+		}
+		p.format = p.assembler.format
+		if len(assembled) < 5 || int32(binary.LittleEndian.Uint32(assembled)) != singlePacketHeader {
+			q.deliver(p, nil, &packetError{errBadData, assembled})
+			return
+		}
+		data = assembled
+	default:
+		q.drop(data, addr, errBadData)
+		return
+	}
+	if !acceptHeader(data[4], p.headers) {
+		q.drop(data, addr, errBadData)
+		return
+	}
+	q.deliver(p, data[4:], nil)
+}
+
+// deliver hands the reply to the query in flight, which only expects one.
+func (q *Querier) deliver(p *querierPeer, data []byte, err error) {
+	p.reply <- querierReply{data, err}
+	p.reply = nil
+	p.headers = nil
+}
+
+func (q *Querier) drop(data []byte, addr net.Addr, err error) {
+	log.WithFields(logrus.Fields{
+		"addr": addr,
+		"size": len(data),
+		"err":  err,
+	}).Debug("steam: dropping unexpected udp packet")
+	atomic.AddUint64(&q.dropped, 1)
+}
+
+var errQuerierClosed = errors.New("steam: querier closed")
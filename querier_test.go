@@ -0,0 +1,66 @@
+package steam
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuerier(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 4; i++ {
+		qs, addr := startQueryServer(t, &QueryServerOptions{InfoChallenge: i%2 == 0, MaxPacketSize: 500})
+		defer qs.Close()
+		addrs = append(addrs, addr)
+	}
+	q, err := NewQuerier(&QuerierOptions{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	n := 0
+	for r := range q.Query(context.Background(), addrs, QKInfo|QKPlayers|QKRules) {
+		n++
+		if r.Err != nil {
+			t.Fatalf("%v: %v", r.Addr, r.Err)
+		}
+		if r.Info.Name != "Test Server" || len(r.Players.Players) != 1 || len(r.Rules.Rules) != 101 {
+			t.Fatalf("%v: got %+v", r.Addr, r)
+		}
+	}
+	if n != len(addrs) {
+		t.Fatalf("got %v results, want %v", n, len(addrs))
+	}
+}
+
+func TestQuerierSweep(t *testing.T) {
+	qs, addr := startQueryServer(t, &QueryServerOptions{})
+	defer qs.Close()
+	q, err := NewQuerier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if _, err := q.Info(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	p, release, err := q.acquire(context.Background(), "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.peers) != 2 {
+		t.Fatalf("got %v peers, want 2", len(q.peers))
+	}
+	// Both idle for long, but the second one is still in use.
+	for _, p := range q.peers {
+		p.lastUsed = time.Now().Add(-2 * querierPeerTTL)
+	}
+	q.swept = time.Time{}
+	q.sweep()
+	if len(q.peers) != 1 || q.peers[p.addr.String()] != p {
+		t.Fatalf("got peers %v, want only the one in use", q.peers)
+	}
+}
@@ -0,0 +1,278 @@
+package steam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// QueryProvider supplies the responses of a QueryServer. A method may
+// return nil to leave the request unanswered.
+type QueryProvider interface {
+	Info() *InfoResponse
+	PlayersInfo() *PlayersInfoResponse
+	Rules() *RulesResponse
+}
+
+// QueryServerOptions describes the various query server options.
+type QueryServerOptions struct {
+	// Require a challenge for info requests, as updated Source servers do.
+	// Players and rules requests always require one.
+	InfoChallenge bool
+
+	// Maximum size of the packets sent, larger responses are split. Default
+	// is 1248, the size used by Source servers. It must leave room for the
+	// 12 byte split packet header, and may not exceed the 1500 bytes
+	// clients read.
+	MaxPacketSize int
+}
+
+// QueryServer answers A2S queries on behalf of a game server.
+type QueryServer struct {
+	provider      QueryProvider
+	infoChallenge bool
+	maxPacketSize int
+
+	mu       sync.Mutex
+	conn     net.PacketConn
+	closed   bool
+	packetID int32
+
+	// Key used to derive the challenge of a client from its address, and
+	// the one it replaced, whose challenges are still accepted.
+	key       []byte
+	prevKey   []byte
+	keyExpiry time.Time
+}
+
+const (
+	defaultMaxPacketSize = 1248
+	maxMaxPacketSize     = 1500
+)
+
+// Time after which the challenge key is replaced. Challenges are accepted
+// for one to two lifetimes.
+const queryServerKeyLifetime = 30 * time.Second
+
+// NewQueryServer returns a query server answering with the responses of
+// the provider. It panics if MaxPacketSize is out of range.
+func NewQueryServer(p QueryProvider, os ...*QueryServerOptions) *QueryServer {
+	s := &QueryServer{
+		provider: p,
+	}
+	if len(os) > 0 {
+		o := os[0]
+		s.infoChallenge = o.InfoChallenge
+		s.maxPacketSize = o.MaxPacketSize
+	}
+	if s.maxPacketSize == 0 {
+		s.maxPacketSize = defaultMaxPacketSize
+	}
+	if s.maxPacketSize <= multiPacketHeaderSize || s.maxPacketSize > maxMaxPacketSize {
+		panic("steam: query server MaxPacketSize out of range")
+	}
+	s.rotateKey()
+	return s
+}
+
+// ListenAndServe listens on the UDP address and answers queries. It
+// returns ErrServerClosed once the server is closed.
+func (s *QueryServer) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve answers queries received on conn, which it closes once done. It
+// returns ErrServerClosed once the server is closed. A server only serves
+// one connection, later calls return an error.
+func (s *QueryServer) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return ErrServerClosed
+	}
+	if s.conn != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return errQueryServerServing
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if err := s.handle(conn, addr, buf[:n]); err != nil {
+			log.WithFields(logrus.Fields{
+				"addr": addr,
+				"err":  err,
+			}).Error("steam: could not answer query")
+		}
+	}
+}
+
+// Close stops the server.
+func (s *QueryServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *QueryServer) handle(conn net.PacketConn, addr net.Addr, data []byte) error {
+	if len(data) < 5 || int32(binary.LittleEndian.Uint32(data)) != singlePacketHeader {
+		return nil
+	}
+	data = data[4:]
+	log.WithFields(logrus.Fields{
+		"addr":   addr,
+		"header": string(data[0]),
+	}).Debug("steam: received query")
+	var res binaryMarshaler
+	switch data[0] {
+	case hInfoRequest:
+		var req infoRequest
+		if err := req.unmarshalBinary(data); err != nil {
+			return err
+		}
+		if s.infoChallenge && !s.validChallenge(addr, req.Challenge) {
+			return s.sendChallenge(conn, addr)
+		}
+		if r := s.provider.Info(); r != nil {
+			res = r
+		}
+	case hPlayersInfoRequest:
+		var req playersInfoRequest
+		if err := req.unmarshalBinary(data); err != nil {
+			return err
+		}
+		if !s.validChallenge(addr, req.Challenge) {
+			return s.sendChallenge(conn, addr)
+		}
+		if r := s.provider.PlayersInfo(); r != nil {
+			res = r
+		}
+	case hRulesRequest:
+		var req rulesRequest
+		if err := req.unmarshalBinary(data); err != nil {
+			return err
+		}
+		if !s.validChallenge(addr, req.Challenge) {
+			return s.sendChallenge(conn, addr)
+		}
+		if r := s.provider.Rules(); r != nil {
+			res = r
+		}
+	}
+	if res == nil {
+		return nil
+	}
+	return s.send(conn, addr, res)
+}
+
+// challenge returns the challenge number of a client. It is derived from
+// the address so that no state needs to be kept per client.
+func (s *QueryServer) challenge(addr net.Addr) int {
+	key, _ := s.keys()
+	return keyedChallenge(key, addr)
+}
+
+// validChallenge reports whether c was handed out to the client with the
+// current or the previous key.
+func (s *QueryServer) validChallenge(addr net.Addr, c int) bool {
+	key, prevKey := s.keys()
+	return c == keyedChallenge(key, addr) || prevKey != nil && c == keyedChallenge(prevKey, addr)
+}
+
+// keys returns the current and previous challenge keys, replacing them
+// first if the current one expired.
+func (s *QueryServer) keys() (key, prevKey []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.After(s.keyExpiry) {
+		stale := now.After(s.keyExpiry.Add(queryServerKeyLifetime))
+		s.rotateKey()
+		if stale {
+			s.prevKey = nil
+		}
+	}
+	return s.key, s.prevKey
+}
+
+// rotateKey replaces the challenge key. It must be called with mu held,
+// or before the server is shared.
+func (s *QueryServer) rotateKey() {
+	key := make([]byte, sha1.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	s.prevKey = s.key
+	s.key = key
+	s.keyExpiry = time.Now().Add(queryServerKeyLifetime)
+}
+
+func keyedChallenge(key []byte, addr net.Addr) int {
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(addr.String()))
+	c := int32(binary.LittleEndian.Uint32(mac.Sum(nil)))
+	// Zero means no challenge and -1 asks for one.
+	if c == 0 || c == -1 {
+		c = 1
+	}
+	return int(c)
+}
+
+func (s *QueryServer) sendChallenge(conn net.PacketConn, addr net.Addr) error {
+	return s.send(conn, addr, challengeResponse{s.challenge(addr)})
+}
+
+func (s *QueryServer) send(conn net.PacketConn, addr net.Addr, res binaryMarshaler) error {
+	data, err := res.marshalBinary()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.packetID++
+	id := s.packetID
+	s.mu.Unlock()
+	packets, err := splitResponse(id, data, s.maxPacketSize)
+	if err != nil {
+		return err
+	}
+	for _, p := range packets {
+		if _, err := conn.WriteTo(p, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	ErrServerClosed = errors.New("steam: server closed")
+
+	errResponseTooLarge   = errors.New("steam: response too large")
+	errQueryServerServing = errors.New("steam: query server is already serving")
+	errRCONServerServing  = errors.New("steam: rcon server is already serving")
+)
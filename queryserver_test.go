@@ -0,0 +1,173 @@
+package steam
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testQueryProvider struct{}
+
+func (testQueryProvider) Info() *InfoResponse {
+	return &InfoResponse{
+		Protocol:    17,
+		Name:        "Test Server",
+		Map:         "cp_badlands",
+		Folder:      "tf",
+		Game:        "Team Fortress",
+		ID:          440,
+		Players:     1,
+		MaxPlayers:  24,
+		ServerType:  STDedicated,
+		Environment: ELinux,
+		Visibility:  VPublic,
+		VAC:         VACSecure,
+		Version:     "7370160",
+		Port:        27015,
+	}
+}
+
+func (testQueryProvider) PlayersInfo() *PlayersInfoResponse {
+	return &PlayersInfoResponse{Players: []*Player{{Name: "Player", Score: 7, Duration: 12.5}}}
+}
+
+func (testQueryProvider) Rules() *RulesResponse {
+	rules := map[string]string{"mp_timelimit": "30"}
+	// Large enough to be split.
+	for i := 0; i < 100; i++ {
+		rules["sv_rule_"+string(rune('a'+i%26))+string(rune('a'+i/26))] = "value"
+	}
+	return &RulesResponse{Rules: rules}
+}
+
+// startQueryServer serves the test provider on a local port. The server
+// must be closed.
+func startQueryServer(t *testing.T, o *QueryServerOptions) (*QueryServer, string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewQueryServer(testQueryProvider{}, o)
+	go s.Serve(conn)
+	return s, conn.LocalAddr().String()
+}
+
+func TestQueryServer(t *testing.T) {
+	for _, infoChallenge := range []bool{false, true} {
+		qs, addr := startQueryServer(t, &QueryServerOptions{InfoChallenge: infoChallenge, MaxPacketSize: 500})
+		defer qs.Close()
+		s, err := Connect(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		p := testQueryProvider{}
+
+		info, err := s.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := p.Info()
+		want.RemoteAddr = info.RemoteAddr
+		if !reflect.DeepEqual(info, want) {
+			t.Fatalf("got %+v, want %+v", info, want)
+		}
+		if info.RemoteAddr.String() != addr {
+			t.Fatalf("got remote address %v, want %v", info.RemoteAddr, addr)
+		}
+
+		players, err := s.PlayersInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(players.Players, p.PlayersInfo().Players) {
+			t.Fatalf("got %+v, want %+v", players.Players, p.PlayersInfo().Players)
+		}
+
+		rules, err := s.Rules()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rules.Rules, p.Rules().Rules) {
+			t.Fatalf("got %v, want %v", rules.Rules, p.Rules().Rules)
+		}
+	}
+}
+
+func TestQueryServerChallengeRotation(t *testing.T) {
+	s, _ := startQueryServer(t, &QueryServerOptions{})
+	defer s.Close()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 27005}
+	c := s.challenge(addr)
+	if !s.validChallenge(addr, c) {
+		t.Fatal("fresh challenge rejected")
+	}
+	s.mu.Lock()
+	s.rotateKey()
+	s.mu.Unlock()
+	if !s.validChallenge(addr, c) {
+		t.Fatal("challenge of the previous key rejected")
+	}
+	s.mu.Lock()
+	s.rotateKey()
+	s.mu.Unlock()
+	if s.validChallenge(addr, c) {
+		t.Fatal("expired challenge accepted")
+	}
+	// A key left unused for two lifetimes is not kept as the previous one.
+	c = s.challenge(addr)
+	s.mu.Lock()
+	s.keyExpiry = time.Now().Add(-2 * queryServerKeyLifetime)
+	s.mu.Unlock()
+	if s.validChallenge(addr, c) {
+		t.Fatal("stale challenge accepted")
+	}
+}
+
+func TestQueryServerServeTwice(t *testing.T) {
+	s, _ := startQueryServer(t, &QueryServerOptions{})
+	defer s.Close()
+	// Wait for the first Serve to take its connection.
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		serving := s.conn != nil
+		s.mu.Unlock()
+		if serving {
+			break
+		}
+		if i == 100 {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(conn); err != errQueryServerServing {
+		t.Fatalf("got %v, want %v", err, errQueryServerServing)
+	}
+	s.Close()
+	conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(conn); err != ErrServerClosed {
+		t.Fatalf("got %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestQueryServerMaxPacketSize(t *testing.T) {
+	for _, size := range []int{-1, multiPacketHeaderSize, maxMaxPacketSize + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("size %v: no panic", size)
+				}
+			}()
+			NewQueryServer(testQueryProvider{}, &QueryServerOptions{MaxPacketSize: size})
+		}()
+	}
+	NewQueryServer(testQueryProvider{}, &QueryServerOptions{MaxPacketSize: maxMaxPacketSize})
+}
@@ -0,0 +1,263 @@
+package steam
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Maximum size of an RCON packet, not counting the size field itself.
+const rconMaxPacketSize = 4096
+
+// RCONHandler executes the commands received by an RCONServer. It may be
+// called concurrently for different connections.
+type RCONHandler interface {
+	ServeRCON(cmd string, addr net.Addr) string
+}
+
+// RCONHandlerFunc adapts a function to the RCONHandler interface.
+type RCONHandlerFunc func(cmd string, addr net.Addr) string
+
+// ServeRCON calls f(cmd, addr).
+func (f RCONHandlerFunc) ServeRCON(cmd string, addr net.Addr) string {
+	return f(cmd, addr)
+}
+
+// RCONServerOptions describes the various RCON server options.
+type RCONServerOptions struct {
+	// RCON password.
+	Password string
+
+	// Authenticate checks the password sent by a client. Default compares
+	// it to Password.
+	Authenticate func(password string, addr net.Addr) bool
+}
+
+// RCONServer accepts Source RCON connections and passes the commands
+// received to a handler.
+type RCONServer struct {
+	handler      RCONHandler
+	authenticate func(password string, addr net.Addr) bool
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// NewRCONServer returns an RCON server executing commands with the handler.
+func NewRCONServer(h RCONHandler, os ...*RCONServerOptions) *RCONServer {
+	s := &RCONServer{
+		handler: h,
+		conns:   make(map[net.Conn]bool),
+	}
+	var password string
+	if len(os) > 0 {
+		o := os[0]
+		password = o.Password
+		s.authenticate = o.Authenticate
+	}
+	if s.authenticate == nil {
+		s.authenticate = func(p string, _ net.Addr) bool {
+			return password != "" && p == password
+		}
+	}
+	return s
+}
+
+// ListenAndServe listens on the TCP address and serves RCON connections.
+// It returns ErrServerClosed once the server is closed.
+func (s *RCONServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts RCON connections on l. It returns ErrServerClosed once the
+// server is closed. A server only serves one listener, later calls close
+// theirs and return an error.
+func (s *RCONServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listener != nil {
+		s.mu.Unlock()
+		l.Close()
+		return errRCONServerServing
+	}
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			// Close ran after Accept returned.
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and closes all its connections.
+func (s *RCONServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *RCONServer) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	addr := conn.RemoteAddr()
+	log.WithFields(logrus.Fields{
+		"addr": addr,
+	}).Debug("steam: accepted rcon connection")
+	r := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		data, err := readRCONPacket(r)
+		if err != nil {
+			if err != io.EOF {
+				log.WithFields(logrus.Fields{
+					"addr": addr,
+					"err":  err,
+				}).Error("steam: could not receive rcon request")
+			}
+			return
+		}
+		var req rconRequest
+		if err := req.unmarshalBinary(data); err != nil {
+			log.WithFields(logrus.Fields{
+				"addr": addr,
+				"err":  err,
+			}).Error("steam: decoding rcon request")
+			return
+		}
+		var resps []*rconResponse
+		switch {
+		case req.typ == rrtAuth:
+			authenticated = s.authenticate(req.body, addr)
+			id := req.id
+			if !authenticated {
+				id = -1
+			}
+			log.WithFields(logrus.Fields{
+				"addr":          addr,
+				"authenticated": authenticated,
+			}).Debug("steam: rcon authentication")
+			resps = append(resps,
+				newRCONResponse(req.id, rrtRespValue, nil),
+				newRCONResponse(id, rrtAuthResp, nil))
+		case !authenticated:
+			return
+		case req.typ == rrtExecCmd:
+			out, ok := s.serveRCON(req.body, addr)
+			if !ok {
+				return
+			}
+			resps = execRCONResponses(req.id, out)
+		case req.typ == rrtRespValue:
+			// Mirror the empty packet clients send to find the end of a
+			// response, followed by the trailer SRCDS sends.
+			resps = append(resps,
+				newRCONResponse(req.id, rrtRespValue, nil),
+				newRCONResponse(req.id, rrtRespValue, trailer))
+		default:
+			continue
+		}
+		for _, resp := range resps {
+			data, _ := resp.marshalBinary()
+			if _, err := conn.Write(data); err != nil {
+				log.WithFields(logrus.Fields{
+					"addr": addr,
+					"err":  err,
+				}).Error("steam: sending rcon response")
+				return
+			}
+		}
+	}
+}
+
+// serveRCON runs the handler. If it panics, the panic is logged and ok is
+// false, so only the connection is lost.
+func (s *RCONServer) serveRCON(cmd string, addr net.Addr) (out string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(logrus.Fields{
+				"addr":  addr,
+				"cmd":   cmd,
+				"panic": r,
+			}).Error("steam: rcon handler panicked")
+		}
+	}()
+	return s.handler.ServeRCON(cmd, addr), true
+}
+
+// execRCONResponses splits the output of a command into packets of at most
+// rconMaxPacketSize bytes.
+func execRCONResponses(id int32, output string) []*rconResponse {
+	const chunk = rconMaxPacketSize - 10
+	if output == "" {
+		return []*rconResponse{newRCONResponse(id, rrtRespValue, nil)}
+	}
+	var resps []*rconResponse
+	for len(output) > 0 {
+		n := chunk
+		if n > len(output) {
+			n = len(output)
+		}
+		resps = append(resps, newRCONResponse(id, rrtRespValue, []byte(output[:n])))
+		output = output[n:]
+	}
+	return resps
+}
+
+// readRCONPacket reads a whole packet, including its size field.
+func readRCONPacket(r io.Reader) ([]byte, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 10 || size > rconMaxPacketSize {
+		return nil, errBadData
+	}
+	data := make([]byte, 4+size)
+	binary.LittleEndian.PutUint32(data, uint32(size))
+	if _, err := io.ReadFull(r, data[4:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,137 @@
+package steam
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// startRCONServer serves a handler echoing the commands on a local port.
+// The command "big" prints output spanning several packets, "empty" prints
+// nothing and "panic" panics. The server must be closed.
+func startRCONServer(t *testing.T) (*RCONServer, string) {
+	return startRCONServerOn(t, "127.0.0.1:0")
+}
+
+// startRCONServerOn is like startRCONServer but listens on addr.
+func startRCONServerOn(t *testing.T, addr string) (*RCONServer, string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRCONServer(RCONHandlerFunc(func(cmd string, _ net.Addr) string {
+		switch cmd {
+		case "big":
+			return strings.Repeat("x", 3*rconMaxPacketSize)
+		case "empty":
+			return ""
+		case "panic":
+			panic("handler failed")
+		}
+		return "echo " + cmd
+	}), &RCONServerOptions{Password: "secret"})
+	go s.Serve(l)
+	return s, l.Addr().String()
+}
+
+func TestRCONServer(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tests := []struct {
+		cmd, out string
+	}{
+		{"status", "echo status"},
+		{"big", strings.Repeat("x", 3*rconMaxPacketSize)},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		out, err := s.Send(tt.cmd)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.cmd, err)
+		}
+		if out != tt.out {
+			t.Fatalf("%v: got %q, want %q", tt.cmd, out, tt.out)
+		}
+	}
+}
+
+func TestRCONServerBadPassword(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err = s.Send("x"); !errors.Is(err, ErrRCONAuthFailed) {
+		t.Fatalf("got %v, want %v", err, ErrRCONAuthFailed)
+	}
+}
+
+func TestRCONServerHandlerPanic(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("panic"); err == nil {
+		t.Fatal("command of a panicking handler succeeded")
+	}
+	// The server survived and accepts new connections.
+	s2, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if out, err := s2.Send("x"); err != nil || out != "echo x" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+}
+
+func TestRCONServerClose(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("x"); err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+	if _, err := s.Send("x"); err == nil {
+		t.Fatal("command succeeded after the server closed")
+	}
+}
+
+func TestRCONServerServeTwice(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	// Once a command went through, the first listener is served.
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("x"); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Serve(l); err != errRCONServerServing {
+		t.Fatalf("got %v, want %v", err, errRCONServerServing)
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("second listener left open")
+	}
+}
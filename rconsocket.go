@@ -2,85 +2,317 @@ package steam
 
 import (
 	"bytes"
-	"io"
+	"context"
+	"encoding/binary"
+	"errors"
 	"net"
+	"sync"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
+// rconSocket is a Source RCON connection. Once authenticated, a background
+// reader routes the responses to the commands in flight by their ID, so
+// several commands can share the connection.
 type rconSocket struct {
 	conn net.Conn
+
+	// Deadline of each write, and time to wait for each response packet.
+	timeout time.Duration
+
+	// Serializes writes, so packets are not interleaved.
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int32]*rconCall
+	// Closed once the connection failed, err holds the reason.
+	done chan struct{}
+	err  error
+}
+
+// rconCall collects the response packets of a command.
+type rconCall struct {
+	mu      sync.Mutex
+	packets []*rconResponse
+	ready   chan struct{}
+}
+
+// writeDeadliner limits watchContext to the writes, as the reader may be
+// blocked on the same connection.
+type writeDeadliner struct {
+	net.Conn
+}
+
+func (c writeDeadliner) SetDeadline(t time.Time) error {
+	return c.SetWriteDeadline(t)
 }
 
-func newRCONSocket(dial DialFn, addr string) (*rconSocket, error) {
-	conn, err := dial("tcp", addr)
+type rconTimeoutError struct{}
+
+func (rconTimeoutError) Error() string   { return "steam: rcon response timed out" }
+func (rconTimeoutError) Timeout() bool   { return true }
+func (rconTimeoutError) Temporary() bool { return true }
+
+var (
+	errRCONTimeout = rconTimeoutError{}
+	errRCONClosed  = errors.New("steam: rcon connection closed")
+)
+
+func newRCONSocket(ctx context.Context, dial dialContextFn, addr string, timeout time.Duration) (*rconSocket, error) {
+	conn, err := dial(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
-	return &rconSocket{conn}, nil
+	return &rconSocket{
+		conn:    conn,
+		timeout: timeout,
+		pending: make(map[int32]*rconCall),
+		done:    make(chan struct{}),
+	}, nil
 }
 
 func (s *rconSocket) close() {
+	s.fail(errRCONClosed)
+}
+
+// fail closes the connection, recording err as the reason for the commands
+// still waiting.
+func (s *rconSocket) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
 	s.conn.Close()
+	close(s.done)
+}
+
+// failed returns why the connection failed, or nil if it is still usable.
+func (s *rconSocket) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
 }
 
-func (s *rconSocket) send(p []byte) error {
-	if err := s.conn.SetWriteDeadline(time.Now().Add(400 * time.Millisecond)); err != nil {
+// send writes p. As a partly written packet would corrupt the stream, the
+// connection is closed if the write fails.
+func (s *rconSocket) send(ctx context.Context, p []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := s.failed(); err != nil {
+		return err
+	}
+	if err := s.conn.SetWriteDeadline(contextDeadline(ctx, s.timeout)); err != nil {
 		return err
 	}
+	stop := watchContext(ctx, writeDeadliner{s.conn})
 	_, err := s.conn.Write(p)
+	stop()
 	if err != nil {
+		err = contextError(ctx, err)
+		s.fail(err)
 		return err
 	}
 	return nil
 }
 
-func (s *rconSocket) receive() (_ []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
+// receive reads a whole packet, including its size field. Each read must
+// complete before the read deadline, or before ctx is done. It is only used
+// before the reader is started.
+func (s *rconSocket) receive(ctx context.Context) ([]byte, error) {
+	stop := watchContext(ctx, s.conn)
+	defer stop()
+	data, err := s.readPacket(func() time.Time {
+		return contextDeadline(ctx, s.timeout)
+	})
+	return data, contextError(ctx, err)
+}
+
+// start runs the reader routing the responses to the commands.
+func (s *rconSocket) start() {
+	go s.readLoop()
+}
+
+func (s *rconSocket) readLoop() {
+	for {
+		data, err := s.readPacket(func() time.Time {
+			return time.Time{}
+		})
+		if err != nil {
+			s.fail(err)
+			return
 		}
-	}()
-	buf := new(bytes.Buffer)
-	tr := io.TeeReader(s.conn, buf)
-	total := int(readLong(tr))
+		var resp rconResponse
+		if err := resp.unmarshalBinary(data); err != nil {
+			log.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("steam: decoding response")
+			s.fail(&packetError{err, data})
+			return
+		}
+		s.mu.Lock()
+		c := s.pending[resp.id]
+		s.mu.Unlock()
+		if c == nil {
+			log.WithFields(logrus.Fields{
+				"id": resp.id,
+			}).Debug("steam: dropping rcon response for unknown id")
+			continue
+		}
+		c.mu.Lock()
+		c.packets = append(c.packets, &resp)
+		c.mu.Unlock()
+		select {
+		case c.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *rconSocket) readPacket(deadline func() time.Time) ([]byte, error) {
+	size := make([]byte, 4)
+	if err := s.read(size, deadline); err != nil {
+		return nil, err
+	}
+	total := int(int32(binary.LittleEndian.Uint32(size)))
 	log.WithFields(logrus.Fields{
 		"total": total + 4,
 	}).Debug("steam: reading packet")
-	for total > 0 {
+	if total < 10 {
+		return nil, &packetError{errBadData, size}
+	}
+	buf := make([]byte, 4+total)
+	copy(buf, size)
+	if err := s.read(buf[4:], deadline); err != nil {
 		log.WithFields(logrus.Fields{
-			"bytes": total,
-		}).Debug("steam: reading")
-		b := make([]byte, total)
-		if err := s.conn.SetReadDeadline(time.Now().Add(400 * time.Millisecond)); err != nil {
-			return nil, err
+			"err": err,
+		}).Error("steam: could not receive data")
+		return nil, err
+	}
+	log.WithFields(logrus.Fields{
+		"size": len(buf),
+	}).Debug("steam: read packet")
+	return buf, nil
+}
+
+// read fills p, resetting the read deadline before every read.
+func (s *rconSocket) read(p []byte, deadline func() time.Time) error {
+	for len(p) > 0 {
+		if err := s.conn.SetReadDeadline(deadline()); err != nil {
+			return err
 		}
-		n, err := s.conn.Read(b)
+		n, err := s.conn.Read(p)
 		if n > 0 {
 			log.WithFields(logrus.Fields{
 				"bytes": n,
 			}).Debug("steam: read")
-			_, err := buf.Write(b)
-			if err != nil {
-				return nil, err
+		}
+		p = p[n:]
+		if err != nil && len(p) > 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// register routes the responses with the IDs of reqs to a new call.
+// Requests whose ID is already in flight get a new one.
+func (s *rconSocket) register(reqs ...*rconRequest) *rconCall {
+	c := &rconCall{ready: make(chan struct{}, 1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range reqs {
+		for s.pending[req.id] != nil {
+			*req = *newRCONRequest(req.typ, req.body)
+		}
+		s.pending[req.id] = c
+	}
+	return c
+}
+
+func (s *rconSocket) unregister(reqs ...*rconRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range reqs {
+		delete(s.pending, req.id)
+	}
+}
+
+// next waits for the next response packet of c.
+func (s *rconSocket) next(ctx context.Context, c *rconCall) (*rconResponse, error) {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		if len(c.packets) > 0 {
+			resp := c.packets[0]
+			c.packets = c.packets[1:]
+			c.mu.Unlock()
+			return resp, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.ready:
+		case <-timer.C:
+			return nil, errRCONTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			// Packets may have arrived right before the failure.
+			c.mu.Lock()
+			n := len(c.packets)
+			c.mu.Unlock()
+			if n == 0 {
+				return nil, s.failed()
 			}
-			total -= n
 		}
+	}
+}
+
+// exec runs cmd. It is followed by an empty mirror request, which the
+// server answers after the whole output with an empty response and a
+// trailer, both carrying the ID of the mirror.
+func (s *rconSocket) exec(ctx context.Context, cmd string) (string, error) {
+	req := newRCONRequest(rrtExecCmd, cmd)
+	reqMirror := newRCONRequest(rrtRespValue, "")
+	c := s.register(req, reqMirror)
+	defer s.unregister(req, reqMirror)
+	data, _ := req.marshalBinary()
+	mirror, _ := reqMirror.marshalBinary()
+	if err := s.send(ctx, append(data, mirror...)); err != nil {
+		log.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("steam: sending rcon request")
+		return "", err
+	}
+	var (
+		buf       bytes.Buffer
+		sawMirror bool
+	)
+	for {
+		resp, err := s.next(ctx, c)
 		if err != nil {
 			log.WithFields(logrus.Fields{
 				"err": err,
-			}).Error("steam: could not receive data")
-			if err == io.EOF {
-				return nil, err
+			}).Error("steam: receiving rcon response")
+			return "", err
+		}
+		if resp.typ != rrtRespValue {
+			return "", ErrInvalidResponseType
+		}
+		if !sawMirror && resp.id == reqMirror.id {
+			sawMirror = true
+			continue
+		}
+		if sawMirror {
+			if bytes.Equal(resp.body, trailer) {
+				break
 			}
+			return "", ErrInvalidResponseTrailer
 		}
-		log.WithFields(logrus.Fields{
-			"bytes": total,
-		}).Debug("steam: remaining")
+		buf.Write(resp.body)
 	}
-	log.WithFields(logrus.Fields{
-		"size": buf.Len(),
-	}).Debug("steam: read packet")
-	return buf.Bytes(), nil
+	return buf.String(), nil
 }
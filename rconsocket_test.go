@@ -0,0 +1,48 @@
+package steam
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRCONConcurrentSend(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		cmd, want := fmt.Sprint("cmd", i), fmt.Sprint("echo cmd", i)
+		// Every other command prints output spanning several packets.
+		if i%2 == 0 {
+			cmd, want = "big", strings.Repeat("x", 3*rconMaxPacketSize)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := s.Send(cmd)
+			if err == nil && out != want {
+				err = fmt.Errorf("%v: got %d bytes %.20q, want %d bytes %.20q", cmd, len(out), out, len(want), want)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if len(rs.conns) != 1 {
+		t.Fatalf("commands used %v connections, want 1", len(rs.conns))
+	}
+}
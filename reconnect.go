@@ -0,0 +1,158 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RCONReconnectPolicy describes how a broken Source RCON connection is
+// restored. Attempts and the backoff between them follow the embedded
+// RetryPolicy; at least one attempt is made.
+type RCONReconnectPolicy struct {
+	RetryPolicy
+
+	// Send the command which was in flight again once reconnected. The
+	// server may already have run it, so only enable this for commands
+	// which can safely run twice. Commands are only replayed if the server
+	// closed or reset the connection, never after a timeout.
+	Replay bool
+
+	// Called for every reconnect event. It runs while the server is
+	// locked, so it must not call methods of the server.
+	OnEvent func(RCONReconnectEvent)
+}
+
+type RCONReconnectEventType int
+
+const (
+	// The connection broke.
+	RREDisconnected RCONReconnectEventType = iota
+	// An attempt to reconnect failed.
+	RREAttemptFailed
+	// The connection was restored.
+	RREReconnected
+	// No more attempts are left.
+	RREGaveUp
+)
+
+var rconReconnectEventTypeStrings = map[RCONReconnectEventType]string{
+	RREDisconnected:  "disconnected",
+	RREAttemptFailed: "attempt failed",
+	RREReconnected:   "reconnected",
+	RREGaveUp:        "gave up",
+}
+
+func (t RCONReconnectEventType) String() string {
+	return rconReconnectEventTypeStrings[t]
+}
+
+// RCONReconnectEvent reports the progress of restoring an RCON
+// connection.
+type RCONReconnectEvent struct {
+	Type RCONReconnectEventType
+	Addr string
+
+	// Number of the attempt, counting from one. Zero for RREDisconnected.
+	Attempt int
+
+	// Error which broke the connection or made the attempt fail.
+	Err error
+}
+
+// rconReconnect is a reconnect in progress. Commands needing the
+// connection meanwhile wait for it to finish and share its error.
+type rconReconnect struct {
+	done chan struct{}
+	err  error
+}
+
+// reconnectRCON redials and authenticates the RCON connection, waiting
+// between attempts as the reconnect policy says. It must be called with
+// rconMu held, which is released during the waits, so that they hold up
+// neither Close nor the queries. Close cancels the reconnect.
+func (s *Server) reconnectRCON(ctx context.Context) (err error) {
+	r := &rconReconnect{done: make(chan struct{})}
+	s.rconReconnecting = r
+	defer func() {
+		s.rconReconnecting = nil
+		r.err = err
+		close(r.done)
+	}()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		// Close may have run while the lock was released.
+		if s.isClosed() {
+			return errClosed
+		}
+		err = s.initRCON(ctx)
+		if err == nil {
+			s.rconReconnectEvent(RCONReconnectEvent{Type: RREReconnected, Attempt: attempt})
+			return nil
+		}
+		log.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"err":     err,
+		}).Debug("steam: could not reconnect rcon")
+		s.rconReconnectEvent(RCONReconnectEvent{Type: RREAttemptFailed, Attempt: attempt, Err: err})
+		if s.isClosed() {
+			err = errClosed
+		}
+		// A wrong password will not get right by trying again.
+		if errors.Is(err, ErrRCONAuthFailed) || errors.Is(err, ErrRCONBanned) || ctx.Err() != nil || attempt >= s.reconnect.MaxAttempts {
+			s.rconReconnectEvent(RCONReconnectEvent{Type: RREGaveUp, Attempt: attempt, Err: err})
+			return err
+		}
+		s.rconMu.Unlock()
+		err = sleepContext(ctx, s.reconnect.backoff(attempt-1))
+		s.rconMu.Lock()
+		if err != nil {
+			if s.isClosed() {
+				err = errClosed
+			}
+			s.rconReconnectEvent(RCONReconnectEvent{Type: RREGaveUp, Attempt: attempt, Err: err})
+			return err
+		}
+	}
+}
+
+// waitRCONReconnect waits for the reconnect started by another command. It
+// must be called with rconMu held, which is released while waiting.
+func (s *Server) waitRCONReconnect(ctx context.Context) error {
+	r := s.rconReconnecting
+	s.rconMu.Unlock()
+	defer s.rconMu.Lock()
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) rconReconnectEvent(e RCONReconnectEvent) {
+	if s.reconnect == nil || s.reconnect.OnEvent == nil {
+		return
+	}
+	e.Addr = s.rconAddr
+	s.reconnect.OnEvent(e)
+}
+
+// isConnBreak reports whether err means the server closed or reset the
+// connection, as opposed to a timeout or a garbled packet.
+func isConnBreak(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,139 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsConnBreak(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{errRCONTimeout, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errRCONTimeout}, false},
+		{context.DeadlineExceeded, false},
+		{&packetError{errBadData, nil}, false},
+	}
+	for _, tt := range tests {
+		if got := isConnBreak(tt.err); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRCONReconnectClose(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	attempts := make(chan struct{}, 10)
+	s, err := NewRCONClient(addr, &ConnectOptions{
+		RCONPassword: "secret",
+		RCONReconnect: &RCONReconnectPolicy{
+			RetryPolicy: RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+			OnEvent: func(e RCONReconnectEvent) {
+				if e.Type == RREAttemptFailed {
+					attempts <- struct{}{}
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("status"); err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := s.Send("status")
+			errs <- err
+		}()
+	}
+	select {
+	case <-attempts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reconnect attempt")
+	}
+	// The backoff must hold up neither Close nor the commands waiting for
+	// the reconnect, which all give up.
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Fatal("send succeeded")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("send still waiting for the reconnect")
+		}
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close waited for the backoff")
+	}
+	if _, err := s.Send("status"); !errors.Is(err, errClosed) {
+		t.Fatalf("got error %v, want %v", err, errClosed)
+	}
+}
+
+func TestRCONReconnect(t *testing.T) {
+	rs, addr := startRCONServer(t)
+	events := make(chan RCONReconnectEventType, 10)
+	s, err := NewRCONClient(addr, &ConnectOptions{
+		RCONPassword: "secret",
+		RCONReconnect: &RCONReconnectPolicy{
+			RetryPolicy: RetryPolicy{MaxAttempts: 1},
+			OnEvent: func(e RCONReconnectEvent) {
+				events <- e.Type
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Send("status"); err != nil {
+		t.Fatal(err)
+	}
+	// The only attempt fails while the server is down.
+	rs.Close()
+	if _, err := s.Send("status"); err == nil {
+		t.Fatal("send succeeded while the server was down")
+	}
+	rs, _ = startRCONServerOn(t, addr)
+	defer rs.Close()
+	out, err := s.Send("status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "echo status" {
+		t.Fatalf("got %q, want %q", out, "echo status")
+	}
+	close(events)
+	var got []RCONReconnectEventType
+	for e := range events {
+		got = append(got, e)
+	}
+	want := []RCONReconnectEventType{RREDisconnected, RREAttemptFailed, RREGaveUp, RREReconnected}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy describes how queries are retried after a timeout. Between
+// attempts the client waits for a backoff which starts at InitialBackoff
+// and is multiplied by Multiplier after every attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	// Number of attempts, including the first one. Zero or one disables
+	// retries.
+	MaxAttempts int
+
+	// Default is 100ms.
+	InitialBackoff time.Duration
+
+	// Default is 2s.
+	MaxBackoff time.Duration
+
+	// Default is 2.
+	Multiplier float64
+
+	// Fraction of the backoff by which it is randomly shortened or
+	// lengthened, between 0 and 1. Default is no jitter.
+	Jitter float64
+}
+
+// backoff returns the time to wait after the given attempt, counting from
+// zero.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = 2 * time.Second
+	}
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	backoff := float64(d)
+	for i := 0; i < attempt && backoff < float64(max); i++ {
+		backoff *= mult
+	}
+	if backoff > float64(max) {
+		backoff = float64(max)
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(backoff)
+}
+
+// retry calls fn until it succeeds, the policy runs out of attempts or ctx
+// is done. Only timeouts are retried, as other errors would happen again.
+func retry(ctx context.Context, p *RetryPolicy, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || p == nil || attempt+1 >= p.MaxAttempts || !isTimeout(err) || ctx.Err() != nil {
+			return err
+		}
+		backoff := p.backoff(attempt)
+		log.WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"backoff": backoff,
+		}).Debug("steam: retrying query")
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,86 @@
+package steam
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{
+			name:   "defaults",
+			policy: RetryPolicy{},
+			want:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:   "custom",
+			policy: RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 3},
+			want:   []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 90 * time.Millisecond, 100 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for attempt, want := range tt.want {
+				if got := tt.policy.backoff(attempt); got != want {
+					t.Errorf("attempt %v: got %v, want %v", attempt, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(0); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("got %v, want between 50ms and 150ms", d)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	tests := []struct {
+		name   string
+		policy *RetryPolicy
+		errs   []error
+		calls  int
+		err    error
+	}{
+		{"success", policy, []error{nil}, 1, nil},
+		{"timeouts then success", policy, []error{errRCONTimeout, errRCONTimeout, nil}, 3, nil},
+		{"out of attempts", policy, []error{errRCONTimeout, errRCONTimeout, errRCONTimeout}, 3, errRCONTimeout},
+		{"other error", policy, []error{errBadData}, 1, errBadData},
+		{"no policy", nil, []error{errRCONTimeout}, 1, errRCONTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry(context.Background(), tt.policy, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if err != tt.err || calls != tt.calls {
+				t.Fatalf("got %v after %v calls, want %v after %v", err, calls, tt.err, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := retry(ctx, &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}, func() error {
+		calls++
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return errRCONTimeout
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Fatalf("got %v after %v calls, want %v after 1", err, calls, context.Canceled)
+	}
+}
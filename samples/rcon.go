@@ -1,3 +1,6 @@
+//go:build ignore
+// +build ignore
+
 package main
 
 import (
@@ -6,8 +9,8 @@ import (
 	"os"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/kidoman/go-steam"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -22,24 +25,35 @@ func main() {
 		fmt.Println("Please set ADDR & RCON_PASSWORD.")
 		return
 	}
+	o := &steam.ConnectOptions{
+		RCONPassword: pass,
+		RCONReconnect: &steam.RCONReconnectPolicy{
+			RetryPolicy: steam.RetryPolicy{
+				MaxAttempts:    10,
+				InitialBackoff: 1 * time.Second,
+				MaxBackoff:     30 * time.Second,
+				Jitter:         0.2,
+			},
+			Replay: true,
+			OnEvent: func(e steam.RCONReconnectEvent) {
+				fmt.Printf("rcon %v: %v (attempt %v, err %v)\n", e.Addr, e.Type, e.Attempt, e.Err)
+			},
+		},
+	}
+	rcon, err := steam.Connect(addr, o)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer rcon.Close()
 	for {
-		o := &steam.ConnectOptions{RCONPassword: pass}
-		rcon, err := steam.Connect(addr, o)
+		resp, err := rcon.Send("status")
 		if err != nil {
 			fmt.Println(err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		defer rcon.Close()
-		for {
-			resp, err := rcon.Send("status")
-			if err != nil {
-				fmt.Println(err)
-				break
-			}
+		} else {
 			fmt.Println(resp)
-			time.Sleep(5 * time.Second)
 		}
+		time.Sleep(5 * time.Second)
 	}
 }
 
@@ -1,3 +1,6 @@
+//go:build ignore
+// +build ignore
+
 package main
 
 import (
@@ -5,8 +8,8 @@ import (
 	"fmt"
 	"os"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/kidoman/go-steam"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -48,6 +51,15 @@ func main() {
 			fmt.Printf("steam: %v %v\n", player.Name, player.Score)
 		}
 	}
+	rules, err := server.Rules()
+	if err != nil {
+		fmt.Printf("steam: could not get rules from %v: %v\n", addr, err)
+		return
+	}
+	fmt.Printf("steam: rules of %v:\n", addr)
+	for name, value := range rules.Rules {
+		fmt.Printf("steam: %v = %v\n", name, value)
+	}
 }
 
 func must(err error) {
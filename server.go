@@ -1,33 +1,90 @@
 package steam
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	logrus "github.com/Sirupsen/logrus"
+	logrus "github.com/sirupsen/logrus"
 )
 
 type DialFn func(network, address string) (net.Conn, error)
 
+type dialContextFn func(ctx context.Context, network, address string) (net.Conn, error)
+
+const (
+	defaultDialTimeout  = 1 * time.Second
+	defaultQueryTimeout = 1 * time.Second
+	defaultRCONTimeout  = 400 * time.Millisecond
+)
+
 // Server represents a Source engine game server.
 type Server struct {
+	// Packets dropped by the GoldSrc RCON socket, first for 64-bit
+	// alignment.
+	rconDropped uint64
+
 	addr string
 
-	dial DialFn
+	// Addresses of the query and RCON ports, which default to addr.
+	queryAddr string
+	rconAddr  string
+
+	dial dialContextFn
 
 	rconPassword string
+	rconProtocol RCONProtocol
+
+	splitPacketFormat SplitPacketFormat
+
+	unconnected bool
+	replyAddrs  []string
 
-	usock          *udpSocket
-	udpInitialized bool
+	queryTimeout time.Duration
+	rconTimeout  time.Duration
+	retry        *RetryPolicy
+	reconnect    *RCONReconnectPolicy
+
+	udp *udpPool
 
 	rsock           *rconSocket
 	rconInitialized bool
 
-	mu sync.Mutex
+	// Reconnect in progress, which other commands wait for.
+	rconReconnecting *rconReconnect
+
+	// Set until the RCON connection is first opened, which is then left to
+	// the first command.
+	rconLazy bool
+
+	// Socket for GoldSrc RCON, which is UDP based.
+	rconUDPSock *udpSocket
+
+	// Challenge for info requests, cached once the server hands one out.
+	infoChallenge int
+
+	// Challenge for GoldSrc RCON commands.
+	rconChallenge string
+
+	// App ID reported by the last info response, used to decode game
+	// specific fields of other responses.
+	appID int
+
+	// Guards infoChallenge and appID. Queries only hold it to read or
+	// update them, so they run concurrently.
+	queryMu sync.Mutex
+
+	// Guards the RCON state. Source RCON commands only hold it to get the
+	// connection, GoldSrc ones for the whole exchange.
+	rconMu sync.Mutex
+
+	// Closed by Close, which stops reconnecting.
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // ConnectOptions describes the various connections options.
@@ -38,35 +95,185 @@ type ConnectOptions struct {
 
 	// RCON password.
 	RCONPassword string
+
+	// Protocol used for RCON. Default is the TCP based Source protocol,
+	// set it to RPGoldSrc for the UDP based protocol of GoldSrc servers.
+	RCONProtocol RCONProtocol
+
+	// Format of split responses. Default will detect it, set it to
+	// SPFGoldSrc or SPFSource to skip the detection.
+	SplitPacketFormat SplitPacketFormat
+
+	// Use unconnected UDP sockets, which also accept replies from
+	// ReplyAddrs. Dial is then not used for UDP. Default only accepts
+	// replies from the address of the server.
+	Unconnected bool
+
+	// Addresses other than the one of the server allowed to reply in
+	// unconnected mode. Entries without a port allow any port.
+	ReplyAddrs []string
+
+	// Address for queries, if the server answers them on another port.
+	// Default is the address passed to Connect.
+	QueryAddr string
+
+	// Address for RCON, if the server accepts it on another port. Default
+	// is the address passed to Connect.
+	RCONAddr string
+
+	// Timeout for establishing connections. Default is 1s. A custom Dial
+	// is only limited if this is set.
+	DialTimeout time.Duration
+
+	// Time to wait for the response to a query, including all of its
+	// packets. Default is 1s.
+	QueryTimeout time.Duration
+
+	// Deadline of each write on the RCON connection, and time to wait for
+	// each packet of a response. For GoldSrc RCON, time to wait for the
+	// challenge and for the first packet of a response. Default is 400ms.
+	RCONTimeout time.Duration
+
+	// Policy for retrying queries which timed out. Default is not to
+	// retry.
+	Retry *RetryPolicy
+
+	// Policy for restoring a broken Source RCON connection. Default is to
+	// return the error, after which Send fails with ErrRCONNotInitialized.
+	RCONReconnect *RCONReconnectPolicy
 }
 
-// Connect to the source server.
-func Connect(addr string, os ...*ConnectOptions) (_ *Server, err error) {
-	s := &Server{
-		addr: addr,
-	}
-	if len(os) > 0 {
-		o := os[0]
-		s.dial = o.Dial
-		s.rconPassword = o.RCONPassword
+// newDialContext returns a context aware version of dial which gives up
+// after timeout. Default will use net.Dialer.DialContext with a 1s
+// timeout.
+func newDialContext(dial DialFn, timeout time.Duration) dialContextFn {
+	if dial == nil {
+		if timeout <= 0 {
+			timeout = defaultDialTimeout
+		}
+		return (&net.Dialer{
+			Timeout: timeout,
+		}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return dialContext(ctx, dial, network, address)
 	}
-	if s.dial == nil {
-		s.dial = (&net.Dialer{
-			Timeout: 1 * time.Second,
-		}).Dial
+}
+
+// Connect to the source server. The query socket is opened right away,
+// and the RCON connection too if a password is set.
+func Connect(addr string, os ...*ConnectOptions) (*Server, error) {
+	return ConnectContext(context.Background(), addr, os...)
+}
+
+// ConnectContext connects to the source server. The context only applies
+// to the connection and authentication.
+func ConnectContext(ctx context.Context, addr string, os ...*ConnectOptions) (_ *Server, err error) {
+	s, err := newServer(addr, os...)
+	if err != nil {
+		return nil, err
 	}
-	if err := s.init(); err != nil {
+	defer func() {
+		if err != nil {
+			s.udp.close()
+		}
+	}()
+	if err := s.init(ctx); err != nil {
 		return nil, err
 	}
 	if s.rconPassword == "" {
 		return s, nil
 	}
-	defer func() {
-		if err != nil {
-			s.usock.close()
+	if err := s.initRCON(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewQueryClient returns a server which is only queried. The query sockets
+// are opened on first use, so nothing is sent until then. RCON is not
+// used, even if a password is set.
+func NewQueryClient(addr string, os ...*ConnectOptions) (*Server, error) {
+	s, err := newServer(addr, os...)
+	if err != nil {
+		return nil, err
+	}
+	s.rconPassword = ""
+	return s, nil
+}
+
+// NewRCONClient returns a server which is sent RCON commands. The RCON
+// connection is opened and authenticated by the first command, which
+// returns the error if that fails; the next command then tries again.
+// Queries are possible too, and also open their sockets on first use.
+func NewRCONClient(addr string, os ...*ConnectOptions) (*Server, error) {
+	s, err := newServer(addr, os...)
+	if err != nil {
+		return nil, err
+	}
+	if s.rconPassword == "" {
+		s.udp.close()
+		return nil, errors.New("steam: rcon client needs a password")
+	}
+	s.rconLazy = true
+	return s, nil
+}
+
+// newServer applies the options, without opening any socket.
+func newServer(addr string, os ...*ConnectOptions) (*Server, error) {
+	s := &Server{
+		addr:         addr,
+		queryAddr:    addr,
+		rconAddr:     addr,
+		queryTimeout: defaultQueryTimeout,
+		rconTimeout:  defaultRCONTimeout,
+		closed:       make(chan struct{}),
+	}
+	var (
+		dial        DialFn
+		dialTimeout time.Duration
+	)
+	if len(os) > 0 {
+		o := os[0]
+		dial = o.Dial
+		dialTimeout = o.DialTimeout
+		s.rconPassword = o.RCONPassword
+		s.rconProtocol = o.RCONProtocol
+		s.splitPacketFormat = o.SplitPacketFormat
+		s.unconnected = o.Unconnected
+		s.replyAddrs = o.ReplyAddrs
+		if o.QueryAddr != "" {
+			s.queryAddr = o.QueryAddr
 		}
-	}()
-	if err := s.initRCON(); err != nil {
+		if o.RCONAddr != "" {
+			s.rconAddr = o.RCONAddr
+		}
+		if o.QueryTimeout > 0 {
+			s.queryTimeout = o.QueryTimeout
+		}
+		if o.RCONTimeout > 0 {
+			s.rconTimeout = o.RCONTimeout
+		}
+		if o.Retry != nil {
+			retry := *o.Retry
+			s.retry = &retry
+		}
+		if o.RCONReconnect != nil {
+			reconnect := *o.RCONReconnect
+			s.reconnect = &reconnect
+		}
+	}
+	if s.queryAddr == "" {
+		return nil, errors.New("steam: server needs a address")
+	}
+	s.dial = newDialContext(dial, dialTimeout)
+	var err error
+	if s.udp, err = s.newUDPPool(s.queryAddr); err != nil {
 		return nil, err
 	}
 	return s, nil
@@ -76,59 +283,108 @@ func (s *Server) String() string {
 	return s.addr
 }
 
-func (s *Server) init() error {
-	if s.addr == "" {
-		return errors.New("steam: server needs a address")
-	}
-	var err error
-	if s.usock, err = newUDPSocket(s.dial, s.addr); err != nil {
+// init opens a query socket, so Connect fails early if that is not
+// possible.
+func (s *Server) init(ctx context.Context) error {
+	usock, err := s.udp.get(ctx)
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Error("steam: could not open udp socket")
 		return err
 	}
+	s.udp.put(usock, nil)
 	return nil
 }
 
-func (s *Server) initRCON() (err error) {
-	if s.addr == "" {
+// newUDPPool returns a pool of sockets to addr, which are unconnected if
+// the options say so.
+func (s *Server) newUDPPool(addr string) (*udpPool, error) {
+	accept, err := s.replyFilter(addr)
+	if err != nil {
+		return nil, err
+	}
+	return newUDPPool(s.dial, addr, accept, s.splitPacketFormat, s.queryTimeout), nil
+}
+
+// newRCONUDPSocket opens the socket of GoldSrc RCON, which is unconnected
+// if the options say so. It is kept open for the commands while they
+// succeed, unlike the sockets of the queries.
+func (s *Server) newRCONUDPSocket(ctx context.Context) (*udpSocket, error) {
+	accept, err := s.replyFilter(s.rconAddr)
+	if err != nil {
+		return nil, err
+	}
+	var usock *udpSocket
+	if accept != nil {
+		usock, err = listenUDPSocket(s.rconAddr, accept, s.splitPacketFormat, s.rconTimeout)
+	} else {
+		usock, err = newUDPSocket(ctx, s.dial, s.rconAddr, s.splitPacketFormat, s.rconTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	usock.dropped = &s.rconDropped
+	return usock, nil
+}
+
+// replyFilter returns the filter of the replies of unconnected sockets to
+// addr, or nil if sockets are connected.
+func (s *Server) replyFilter(addr string) (func(net.Addr) bool, error) {
+	if !s.unconnected {
+		return nil, nil
+	}
+	return newReplyFilter(addr, s.replyAddrs)
+}
+
+func (s *Server) initRCON(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = newOpError(OpRCONAuth, s.rconAddr, err, nil)
+		}
+	}()
+	if s.rconAddr == "" {
 		return errors.New("steam: server needs a address")
 	}
+	if s.rconProtocol == RPGoldSrc {
+		return s.initGoldSrcRCON(ctx)
+	}
 	log.WithFields(logrus.Fields{
-		"addr": s.addr,
+		"addr": s.rconAddr,
 	}).Debug("steam: connecting rcon")
-	if s.rsock, err = newRCONSocket(s.dial, s.addr); err != nil {
+	// The broken connection is only replaced once the new one is
+	// authenticated, so that a failed attempt leaves something to restore.
+	rsock, err := newRCONSocket(ctx, s.dial, s.rconAddr, s.rconTimeout)
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Error("steam: could not open tcp socket")
 		return err
 	}
-	defer func() {
-		if err != nil {
-			s.rsock.close()
-		}
-	}()
-	if err := s.authenticate(); err != nil {
+	if err := s.authenticate(ctx, rsock); err != nil {
 		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Error("steam: could not authenticate")
+		rsock.close()
 		return err
 	}
+	rsock.start()
+	s.rsock = rsock
 	s.rconInitialized = true
 	return nil
 }
 
-func (s *Server) authenticate() error {
+func (s *Server) authenticate(ctx context.Context, rsock *rconSocket) error {
 	log.WithFields(logrus.Fields{
-		"addr": s.addr,
+		"addr": s.rconAddr,
 	}).Debug("steam: authenticating")
 	req := newRCONRequest(rrtAuth, s.rconPassword)
 	data, _ := req.marshalBinary()
-	if err := s.rsock.send(data); err != nil {
+	if err := rsock.send(ctx, data); err != nil {
 		return err
 	}
 	// Receive the empty response value
-	data, err := s.rsock.receive()
+	data, err := rsock.receive(ctx)
 	if err != nil {
 		return err
 	}
@@ -137,7 +393,7 @@ func (s *Server) authenticate() error {
 	}).Debug("steam: received empty response")
 	var resp rconResponse
 	if err := resp.unmarshalBinary(data); err != nil {
-		return err
+		return &packetError{err, data}
 	}
 	if resp.typ != rrtRespValue || resp.id != req.id {
 		return ErrInvalidResponseID
@@ -146,12 +402,12 @@ func (s *Server) authenticate() error {
 		return ErrInvalidResponseType
 	}
 	// Receive the actual auth response
-	data, err = s.rsock.receive()
+	data, err = rsock.receive(ctx)
 	if err != nil {
 		return err
 	}
 	if err := resp.unmarshalBinary(data); err != nil {
-		return err
+		return &packetError{err, data}
 	}
 	if resp.typ != rrtAuthResp || resp.id != req.id {
 		return ErrRCONAuthFailed
@@ -162,41 +418,74 @@ func (s *Server) authenticate() error {
 
 // Close releases the resources associated with this server.
 func (s *Server) Close() {
-	if s.rconInitialized {
+	// Closed first, so that a reconnect holding the lock gives up.
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.rconMu.Lock()
+	if s.rsock != nil {
 		s.rsock.close()
 	}
-	s.usock.close()
+	s.rconInitialized = false
+	if s.rconUDPSock != nil {
+		s.rconUDPSock.close()
+	}
+	s.rconLazy = false
+	s.rconMu.Unlock()
+	s.udp.close()
+}
+
+// DroppedPackets returns the number of UDP packets which were dropped as
+// they did not answer the request, such as late replies to queries which
+// timed out.
+func (s *Server) DroppedPackets() uint64 {
+	return s.udp.droppedPackets() + atomic.LoadUint64(&s.rconDropped)
 }
 
 // Ping returns the RTT (round-trip time) to the server.
 func (s *Server) Ping() (time.Duration, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	req, _ := infoRequest{}.marshalBinary()
-	start := time.Now()
-	s.usock.send(req)
-	if _, err := s.usock.receive(); err != nil {
-		return 0, err
+	return s.PingContext(context.Background())
+}
+
+// PingContext is like Ping but stops waiting once ctx is done.
+func (s *Server) PingContext(ctx context.Context) (time.Duration, error) {
+	var start time.Time
+	challenge := s.cachedInfoChallenge()
+	_, _, err := s.challengeQuery(ctx, func(challenge int) []byte {
+		// Only time the last round trip if the server asks for a
+		// challenge.
+		start = time.Now()
+		req, _ := infoRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hInfoResponse, hInfoObsoleteResponse)
+	if err != nil {
+		return 0, newOpError(OpInfo, s.queryAddr, err, nil)
 	}
+	s.queryMu.Lock()
+	s.infoChallenge = challenge
+	s.queryMu.Unlock()
 	elapsed := time.Since(start)
 	return elapsed, nil
 }
 
 // Info retrieves server information.
 func (s *Server) Info() (*InfoResponse, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	req, _ := infoRequest{}.marshalBinary()
-	if err := s.usock.send(req); err != nil {
-		return nil, err
-	}
+	return s.InfoContext(context.Background())
+}
+
+// InfoContext is like Info but stops waiting once ctx is done.
+func (s *Server) InfoContext(ctx context.Context) (*InfoResponse, error) {
 	log.Debug("receiving info response")
-	data, err := s.usock.receive()
+	challenge := s.cachedInfoChallenge()
+	data, from, err := s.challengeQuery(ctx, func(challenge int) []byte {
+		req, _ := infoRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hInfoResponse, hInfoObsoleteResponse)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Error("could not receive info response")
-		return nil, err
+		return nil, newOpError(OpInfo, s.queryAddr, err, nil)
 	}
 	log.WithFields(logrus.Fields{
 		"data": data,
@@ -206,122 +495,269 @@ func (s *Server) Info() (*InfoResponse, error) {
 		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Error("could not unmarshal info response")
-		return nil, err
+		return nil, newOpError(OpInfo, s.queryAddr, err, data)
 	}
+	res.RemoteAddr = from
+	s.queryMu.Lock()
+	s.infoChallenge = challenge
+	s.appID = res.ID
+	s.queryMu.Unlock()
 	return &res, nil
 }
 
-// PlayersInfo retrieves player information from the server.
+func (s *Server) cachedInfoChallenge() int {
+	s.queryMu.Lock()
+	defer s.queryMu.Unlock()
+	return s.infoChallenge
+}
+
+// PlayersInfo retrieves player information from the server. The fields of
+// The Ship are decoded if Info identified the game, or if the response has
+// room for them.
 func (s *Server) PlayersInfo() (*PlayersInfoResponse, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	// Send the challenge request
-	req, _ := playersInfoRequest{}.marshalBinary()
-	if err := s.usock.send(req); err != nil {
-		return nil, err
-	}
-	data, err := s.usock.receive()
+	return s.PlayersInfoContext(context.Background())
+}
+
+// PlayersInfoContext is like PlayersInfo but stops waiting once ctx is
+// done.
+func (s *Server) PlayersInfoContext(ctx context.Context) (*PlayersInfoResponse, error) {
+	var challenge int
+	data, from, err := s.challengeQuery(ctx, func(challenge int) []byte {
+		req, _ := playersInfoRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hPlayersInfoResponse)
 	if err != nil {
-		return nil, err
-	}
-	if isPlayersInfoChallengeResponse(data) {
-		// Parse the challenge response
-		var challangeRes playersInfoChallengeResponse
-		if err := challangeRes.unmarshalBinary(data); err != nil {
-			return nil, err
-		}
-		// Send a new request with the proper challenge number
-		req, _ = playersInfoRequest{challangeRes.Challenge}.marshalBinary()
-		if err := s.usock.send(req); err != nil {
-			return nil, err
-		}
-		data, err = s.usock.receive()
-		if err != nil {
-			return nil, err
-		}
+		return nil, newOpError(OpPlayers, s.queryAddr, err, nil)
 	}
 	// Parse the return value
+	s.queryMu.Lock()
+	appID := s.appID
+	s.queryMu.Unlock()
 	var res PlayersInfoResponse
-	if err := res.unmarshalBinary(data); err != nil {
-		return nil, err
+	if err := res.unmarshalBinary(data, appID); err != nil {
+		return nil, newOpError(OpPlayers, s.queryAddr, err, data)
 	}
+	res.RemoteAddr = from
 	return &res, nil
 }
 
-// Send RCON command to the server.
-func (s *Server) Send(cmd string) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if !s.rconInitialized {
-		return "", ErrRCONNotInitialized
-	}
-	req := newRCONRequest(rrtExecCmd, cmd)
-	data, _ := req.marshalBinary()
-	if err := s.rsock.send(data); err != nil {
-		log.WithFields(logrus.Fields{
-			"err": err,
-		}).Error("steam: sending rcon request")
-		return "", err
+// Rules retrieves the public cvars of the server.
+func (s *Server) Rules() (*RulesResponse, error) {
+	return s.RulesContext(context.Background())
+}
+
+// RulesContext is like Rules but stops waiting once ctx is done.
+func (s *Server) RulesContext(ctx context.Context) (*RulesResponse, error) {
+	challenge := -1
+	data, from, err := s.challengeQuery(ctx, func(challenge int) []byte {
+		req, _ := rulesRequest{challenge}.marshalBinary()
+		return req
+	}, &challenge, hRulesResponse)
+	if err != nil {
+		return nil, newOpError(OpRules, s.queryAddr, err, nil)
 	}
-	// Send the mirror packet.
-	reqMirror := newRCONRequest(rrtRespValue, "")
-	data, _ = reqMirror.marshalBinary()
-	if err := s.rsock.send(data); err != nil {
+	var res RulesResponse
+	if err := res.unmarshalBinary(data); err != nil {
 		log.WithFields(logrus.Fields{
 			"err": err,
-		}).Error("steam: sending rcon mirror request")
-		return "", err
+		}).Error("steam: could not unmarshal rules response")
+		return nil, newOpError(OpRules, s.queryAddr, err, data)
 	}
+	res.RemoteAddr = from
+	return &res, nil
+}
+
+// challengeQuery sends the request built by newReq for the given
+// challenge number. If the server answers with a challenge, the challenge
+// number is updated and the request is sent again. The whole exchange is
+// retried after timeouts, following the retry policy. Each attempt has a
+// socket of its own. Responses starting with another header than the
+// given ones, or a challenge where one is expected, are dropped. It also
+// returns the address the response came from.
+func (s *Server) challengeQuery(ctx context.Context, newReq func(challenge int) []byte, challenge *int, headers ...byte) ([]byte, net.Addr, error) {
 	var (
-		buf       bytes.Buffer
-		sawMirror bool
+		data []byte
+		from net.Addr
 	)
-	// Start receiving data.
-	for {
-		data, err := s.rsock.receive()
+	err := retry(ctx, s.retry, func() error {
+		usock, err := s.udp.get(ctx)
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"err": err,
-			}).Error("steam: receiving rcon response")
-			return "", err
-		}
-		var resp rconResponse
-		if err := resp.unmarshalBinary(data); err != nil {
-			log.WithFields(logrus.Fields{
-				"err": err,
-			}).Error("steam: decoding response")
-			return "", err
-		}
-		if resp.typ != rrtRespValue {
-			return "", ErrInvalidResponseType
+			return err
 		}
-		if !sawMirror && resp.id == reqMirror.id {
-			sawMirror = true
-			continue
-		}
-		if sawMirror {
-			if bytes.Compare(resp.body, trailer) == 0 {
-				break
+		data, err = challengeExchange(newReq, challenge, headers, func(req, headers []byte) ([]byte, error) {
+			if err := usock.send(req); err != nil {
+				return nil, err
+			}
+			data, addr, err := usock.receiveFrom(ctx, usock.timeout, headers...)
+			from = addr
+			return data, err
+		})
+		s.udp.put(usock, err)
+		return err
+	})
+	return data, from, err
+}
+
+// challengeExchange sends the request built by newReq through exchange,
+// and sends it again with the new challenge number if the server answers
+// with a challenge. Exchange is passed the headers of the replies to
+// accept, which only include the challenge for the first request.
+func challengeExchange(newReq func(challenge int) []byte, challenge *int, headers []byte, exchange func(req, headers []byte) ([]byte, error)) ([]byte, error) {
+	first := append(append([]byte(nil), headers...), hChallengeResponse)
+	data, err := exchange(newReq(*challenge), first)
+	if err != nil {
+		return nil, err
+	}
+	if !isChallengeResponse(data) {
+		return data, nil
+	}
+	// Parse the challenge response
+	var challengeRes challengeResponse
+	if err := challengeRes.unmarshalBinary(data); err != nil {
+		return nil, &packetError{err, data}
+	}
+	*challenge = challengeRes.Challenge
+	// Send a new request with the proper challenge number
+	return exchange(newReq(*challenge), headers)
+}
+
+// Send RCON command to the server.
+func (s *Server) Send(cmd string) (string, error) {
+	return s.SendContext(context.Background(), cmd)
+}
+
+// SendContext is like Send but stops waiting once ctx is done. Source RCON
+// commands may be sent concurrently, their responses are told apart by
+// their IDs.
+//
+// With a reconnect policy, a connection which broke is restored before
+// the command is sent, or right after the command failed.
+//
+// Errors are of type *OpError.
+func (s *Server) SendContext(ctx context.Context, cmd string) (string, error) {
+	out, err := s.send(ctx, cmd)
+	if err != nil {
+		return out, newOpError(OpRCONExec, s.rconAddr, err, nil)
+	}
+	return out, nil
+}
+
+func (s *Server) send(ctx context.Context, cmd string) (string, error) {
+	if s.rconProtocol == RPGoldSrc {
+		s.rconMu.Lock()
+		defer s.rconMu.Unlock()
+		if !s.rconInitialized {
+			if !s.rconLazy {
+				return "", ErrRCONNotInitialized
+			}
+			if err := s.openRCON(ctx); err != nil {
+				return "", err
 			}
-			return "", ErrInvalidResponseTrailer
 		}
-		if req.id != resp.id {
-			return "", ErrInvalidResponseID
+		return s.sendGoldSrc(ctx, cmd)
+	}
+	rsock, err := s.rcon(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := rsock.exec(ctx, cmd)
+	if err == nil || !s.breakRCON(rsock) {
+		return out, err
+	}
+	if s.reconnect == nil || ctx.Err() != nil {
+		return "", err
+	}
+	rsock, rerr := s.rcon(ctx)
+	// A command which timed out may still be running on the server, so
+	// only one cut off by a broken connection is replayed.
+	if rerr != nil || !s.reconnect.Replay || !isConnBreak(err) {
+		return "", err
+	}
+	log.WithFields(logrus.Fields{
+		"cmd": cmd,
+	}).Debug("steam: replaying rcon command")
+	out, err = rsock.exec(ctx, cmd)
+	if err != nil {
+		s.breakRCON(rsock)
+	}
+	return out, err
+}
+
+// rcon returns the Source RCON connection. It is opened first if that was
+// left to the first command, or restored if it broke and there is a
+// reconnect policy.
+func (s *Server) rcon(ctx context.Context) (*rconSocket, error) {
+	s.rconMu.Lock()
+	defer s.rconMu.Unlock()
+	for !s.rconInitialized {
+		var err error
+		switch {
+		case s.isClosed():
+			err = errClosed
+		case s.rconLazy:
+			err = s.openRCON(ctx)
+		case s.rconReconnecting != nil:
+			err = s.waitRCONReconnect(ctx)
+		case s.reconnect != nil && s.rsock != nil:
+			err = s.reconnectRCON(ctx)
+		default:
+			err = ErrRCONNotInitialized
 		}
-		_, err = buf.Write(resp.body)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
-	return buf.String(), nil
+	return s.rsock, nil
+}
+
+func (s *Server) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// openRCON opens the RCON connection on behalf of the first command. It
+// must be called with rconMu held.
+func (s *Server) openRCON(ctx context.Context) error {
+	if err := s.initRCON(ctx); err != nil {
+		return err
+	}
+	s.rconLazy = false
+	return nil
+}
+
+// breakRCON marks the RCON connection as broken if rsock failed, and
+// reports whether it did.
+func (s *Server) breakRCON(rsock *rconSocket) bool {
+	err := rsock.failed()
+	if err == nil {
+		return false
+	}
+	s.rconMu.Lock()
+	defer s.rconMu.Unlock()
+	// Another command may have noticed first.
+	if s.rsock != rsock || !s.rconInitialized {
+		return true
+	}
+	log.WithFields(logrus.Fields{
+		"err": err,
+	}).Debug("steam: rcon connection broke")
+	s.rconInitialized = false
+	s.rconReconnectEvent(RCONReconnectEvent{Type: RREDisconnected, Err: err})
+	return true
 }
 
 var (
 	trailer = []byte{0x00, 0x01, 0x00, 0x00}
 
 	ErrRCONAuthFailed = errors.New("steam: authentication failed")
+	ErrRCONBanned     = errors.New("steam: banned from server")
 
 	ErrRCONNotInitialized     = errors.New("steam: rcon is not initialized")
+	errClosed                 = errors.New("steam: server closed")
 	ErrInvalidResponseType    = errors.New("steam: invalid response type from server")
 	ErrInvalidResponseID      = errors.New("steam: invalid response id from server")
 	ErrInvalidResponseTrailer = errors.New("steam: invalid response trailer from server")
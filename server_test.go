@@ -0,0 +1,113 @@
+package steam
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestChallengeExchange(t *testing.T) {
+	challengeReply, _ := challengeResponse{42}.marshalBinary()
+	var calls [][]byte
+	challenge := -1
+	data, err := challengeExchange(func(c int) []byte {
+		return []byte{byte(c)}
+	}, &challenge, []byte{hRulesResponse}, func(req, headers []byte) ([]byte, error) {
+		calls = append(calls, headers)
+		if req[0] != 42 {
+			return challengeReply[4:], nil
+		}
+		return []byte("rules"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "rules" || challenge != 42 {
+		t.Fatalf("got %q with challenge %v", data, challenge)
+	}
+	// Only the reply to the first request may be a challenge.
+	want := [][]byte{{hRulesResponse, hChallengeResponse}, {hRulesResponse}}
+	if len(calls) != len(want) {
+		t.Fatalf("got %v exchanges, want %v", len(calls), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(calls[i], want[i]) {
+			t.Errorf("exchange %v accepted %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
+
+// startRedirectingServer answers info requests received on the returned
+// connection from the other one. Each reply is preceded by one from a third
+// socket, which clients in unconnected mode must not accept. The
+// connections must be closed.
+func startRedirectingServer(t *testing.T) (conn, replyConn, otherConn net.PacketConn) {
+	var conns [3]net.PacketConn
+	for i := range conns {
+		var err error
+		if conns[i], err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply, _ := testQueryProvider{}.Info().marshalBinary()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			_, addr, err := conns[0].ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conns[2].WriteTo(reply, addr)
+			conns[1].WriteTo(reply, addr)
+		}
+	}()
+	return conns[0], conns[1], conns[2]
+}
+
+func TestUnconnected(t *testing.T) {
+	conn, replyConn, otherConn := startRedirectingServer(t)
+	defer conn.Close()
+	defer replyConn.Close()
+	defer otherConn.Close()
+	replyAddr := replyConn.LocalAddr().String()
+
+	s, err := NewQueryClient(conn.LocalAddr().String(), &ConnectOptions{
+		Unconnected: true,
+		ReplyAddrs:  []string{replyAddr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	info, err := s.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RemoteAddr.String() != replyAddr {
+		t.Fatalf("got remote address %v, want %v", info.RemoteAddr, replyAddr)
+	}
+	if n := s.DroppedPackets(); n != 1 {
+		t.Fatalf("dropped %v packets, want 1", n)
+	}
+
+	// An entry without a port accepts all ports of the host, so the reply
+	// of the other socket arrives first.
+	s, err = NewQueryClient(conn.LocalAddr().String(), &ConnectOptions{
+		Unconnected: true,
+		ReplyAddrs:  []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	info, err = s.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := otherConn.LocalAddr().String(); info.RemoteAddr.String() != want {
+		t.Fatalf("got remote address %v, want %v", info.RemoteAddr, want)
+	}
+	if n := s.DroppedPackets(); n != 0 {
+		t.Fatalf("dropped %v packets, want 0", n)
+	}
+}
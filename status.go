@@ -0,0 +1,288 @@
+package steam
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerStatus is the output of the status command.
+type ServerStatus struct {
+	Hostname string
+	Version  string
+	Secure   bool
+	Map      string
+
+	// Address from the udp/ip line, and the public address if the server
+	// reports one.
+	Addr       string
+	PublicAddr string
+
+	Players    int
+	Bots       int
+	MaxPlayers int
+
+	Clients []*StatusClient
+}
+
+// StatusClient is a client listed by the status command. Fields which the
+// game does not report are left empty.
+type StatusClient struct {
+	UserID    int
+	Name      string
+	UniqueID  string
+	Connected time.Duration
+	Ping      int
+	Loss      int
+	State     string
+	Rate      int
+	Addr      string
+
+	Bot bool
+}
+
+var (
+	statusPlayersRE  = regexp.MustCompile(`^(\d+)(?: humans?, (\d+) bots?| active)? \((\d+)(?:/\d+)? max\)`)
+	statusPublicIPRE = regexp.MustCompile(`public ip: ([^\s)]+)`)
+	statusSpawnRE    = regexp.MustCompile(`\[\d+: (\S+)`)
+	// CS2 sometimes runs the rate and address columns together.
+	statusRateAddrRE = regexp.MustCompile(`^(\d+)(\D.*)$`)
+)
+
+// Status retrieves the output of the status command.
+func (s *Server) Status() (*ServerStatus, error) {
+	return s.StatusContext(context.Background())
+}
+
+// StatusContext is like Status but stops waiting once ctx is done.
+func (s *Server) StatusContext(ctx context.Context) (*ServerStatus, error) {
+	out, err := s.SendContext(ctx, "status")
+	if err != nil {
+		return nil, err
+	}
+	st, err := ParseStatus(out)
+	if err != nil {
+		return nil, newOpError(OpRCONExec, s.rconAddr, err, nil)
+	}
+	return st, nil
+}
+
+// ParseStatus parses the output of the status command. It handles the
+// layouts of the Source games, such as TF2, CS:GO, L4D2 and GMod, as well
+// as the ones of CS2 and the GoldSrc games.
+func ParseStatus(out string) (*ServerStatus, error) {
+	st := new(ServerStatus)
+	cs2 := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "#end":
+			continue
+		case strings.HasPrefix(trimmed, "---------players"):
+			cs2 = true
+			continue
+		case strings.HasPrefix(trimmed, "# userid"), strings.HasPrefix(trimmed, "id "):
+			// Column headers.
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			if c := parseStatusClient(trimmed[1:]); c != nil {
+				st.Clients = append(st.Clients, c)
+			}
+			continue
+		case cs2:
+			if c := parseCS2StatusClient(trimmed); c != nil {
+				st.Clients = append(st.Clients, c)
+			}
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		switch {
+		case key == "hostname":
+			st.Hostname = value
+		case key == "version":
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				st.Version = fields[0]
+			}
+			for _, f := range fields {
+				if f == "secure" {
+					st.Secure = true
+				}
+			}
+		case key == "map":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				st.Map = fields[0]
+			}
+		case strings.HasPrefix(key, "loaded spawngroup"):
+			// CS2 lists the map as the first spawn group.
+			if m := statusSpawnRE.FindStringSubmatch(value); m != nil && st.Map == "" {
+				st.Map = m[1]
+			}
+		case key == "udp/ip", key == "tcp/ip":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				st.Addr = fields[0]
+			}
+			if m := statusPublicIPRE.FindStringSubmatch(value); m != nil {
+				st.PublicAddr = m[1]
+			}
+		case key == "players":
+			if m := statusPlayersRE.FindStringSubmatch(value); m != nil {
+				st.Players, _ = strconv.Atoi(m[1])
+				st.Bots, _ = strconv.Atoi(m[2])
+				st.MaxPlayers, _ = strconv.Atoi(m[3])
+			}
+		}
+	}
+	if st.Hostname == "" && st.Map == "" {
+		return nil, errBadData
+	}
+	return st, nil
+}
+
+// parseStatusClient parses a client row of the Source layout, without the
+// leading #:
+//
+//	2 "Player" [U:1:12345] 00:25 50 0 active 1.2.3.4:27005
+//	2 1 "Player" STEAM_1:0:123 00:11 50 0 active 196608 1.2.3.4:27005
+//	3 "Bot" BOT active 64
+//	1 "Player" 12 STEAM_0:0:1234 5 12:34 45 0 1.2.3.4:27005
+//
+// CS:GO and L4D2 add a slot column after the user ID and a rate column
+// before the address. GoldSrc lists the slot first, the user ID after the
+// name and a frag count instead of the state.
+func parseStatusClient(row string) *StatusClient {
+	start := strings.Index(row, `"`)
+	end := strings.LastIndex(row, `"`)
+	if start < 0 || end <= start {
+		return nil
+	}
+	before := strings.Fields(row[:start])
+	after := strings.Fields(row[end+1:])
+	if len(before) == 0 || len(after) == 0 {
+		return nil
+	}
+	c := &StatusClient{Name: row[start+1 : end]}
+	if len(after) > 1 && isDigits(after[0]) {
+		return parseGoldSrcStatusClient(c, after)
+	}
+	var err error
+	if c.UserID, err = strconv.Atoi(before[0]); err != nil {
+		return nil
+	}
+	c.UniqueID = after[0]
+	after = after[1:]
+	if c.UniqueID == "BOT" {
+		c.Bot = true
+		if len(after) > 0 {
+			c.State = after[0]
+		}
+		if len(after) > 1 {
+			c.Rate, _ = strconv.Atoi(after[1])
+		}
+		return c
+	}
+	if len(after) < 5 {
+		return nil
+	}
+	c.Connected = parseStatusDuration(after[0])
+	c.Ping, _ = strconv.Atoi(after[1])
+	c.Loss, _ = strconv.Atoi(after[2])
+	c.State = after[3]
+	after = after[4:]
+	if len(after) > 1 {
+		c.Rate, _ = strconv.Atoi(after[0])
+		after = after[1:]
+	}
+	c.Addr = after[0]
+	return c
+}
+
+// parseGoldSrcStatusClient fills c from the columns following the name of
+// a GoldSrc row. Bots have no address.
+func parseGoldSrcStatusClient(c *StatusClient, after []string) *StatusClient {
+	if len(after) < 6 {
+		return nil
+	}
+	c.UserID, _ = strconv.Atoi(after[0])
+	c.UniqueID = after[1]
+	c.Bot = c.UniqueID == "BOT"
+	c.Connected = parseStatusDuration(after[3])
+	c.Ping, _ = strconv.Atoi(after[4])
+	c.Loss, _ = strconv.Atoi(after[5])
+	if len(after) > 6 {
+		c.Addr = after[6]
+	}
+	return c
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseCS2StatusClient parses a client row of the CS2 layout:
+//
+//	2      00:23   30    0     active 786432 1.2.3.4:27005 'Player'
+func parseCS2StatusClient(row string) *StatusClient {
+	start := strings.Index(row, "'")
+	end := strings.LastIndex(row, "'")
+	if start < 0 || end <= start {
+		return nil
+	}
+	fields := strings.Fields(row[:start])
+	if len(fields) == 6 {
+		if m := statusRateAddrRE.FindStringSubmatch(fields[5]); m != nil {
+			fields = append(fields[:5], m[1], m[2])
+		}
+	}
+	if len(fields) < 6 {
+		return nil
+	}
+	c := &StatusClient{Name: row[start+1 : end]}
+	var err error
+	if c.UserID, err = strconv.Atoi(fields[0]); err != nil {
+		return nil
+	}
+	// Connections still being set up carry the maximum slot ID.
+	if c.UserID == 65535 {
+		return nil
+	}
+	if fields[1] == "BOT" {
+		c.Bot = true
+	} else {
+		c.Connected = parseStatusDuration(fields[1])
+	}
+	c.Ping, _ = strconv.Atoi(fields[2])
+	c.Loss, _ = strconv.Atoi(fields[3])
+	c.State = fields[4]
+	c.Rate, _ = strconv.Atoi(fields[5])
+	if len(fields) > 6 {
+		c.Addr = fields[6]
+	}
+	return c
+}
+
+// parseStatusDuration parses a connection time such as 05:12 or 1:05:12.
+func parseStatusDuration(s string) time.Duration {
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
@@ -0,0 +1,216 @@
+package steam
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want *ServerStatus
+	}{
+		{
+			name: "tf2",
+			out: `hostname: My TF2 Server
+version : 7560276/24 7560276 secure
+udp/ip  : 10.0.0.2:27015  (public ip: 1.2.3.4)
+steamid : [G:1:123] (85568392920040315)
+account : not logged in  (No account specified)
+map     : ctf_2fort at: 0 x, 0 y, 0 z
+tags    : cp,increased_maxplayers
+players : 2 humans, 1 bots (24 max)
+edicts  : 426 used of 2048 max
+# userid name                uniqueid            connected ping loss state  adr
+#      2 "Player One"        [U:1:12345]         1:00:25     50    0 active 5.6.7.8:27005
+#      4 "[TAG] "Q" <x>"     [U:1:67890]         05:12       80    2 spawning [2001:db8::1]:27005
+#      3 "Pyro"              BOT                                     active
+`,
+			want: &ServerStatus{
+				Hostname:   "My TF2 Server",
+				Version:    "7560276/24",
+				Secure:     true,
+				Map:        "ctf_2fort",
+				Addr:       "10.0.0.2:27015",
+				PublicAddr: "1.2.3.4",
+				Players:    2,
+				Bots:       1,
+				MaxPlayers: 24,
+				Clients: []*StatusClient{
+					{UserID: 2, Name: "Player One", UniqueID: "[U:1:12345]", Connected: time.Hour + 25*time.Second, Ping: 50, State: "active", Addr: "5.6.7.8:27005"},
+					{UserID: 4, Name: `[TAG] "Q" <x>`, UniqueID: "[U:1:67890]", Connected: 5*time.Minute + 12*time.Second, Ping: 80, Loss: 2, State: "spawning", Addr: "[2001:db8::1]:27005"},
+					{UserID: 3, Name: "Pyro", UniqueID: "BOT", State: "active", Bot: true},
+				},
+			},
+		},
+		{
+			name: "csgo",
+			out: `hostname: CSGO
+version : 1.38.0.0/13800 1192/8012 secure  [G:1:123] 
+udp/ip  : 0.0.0.0:27015  (public ip: 1.2.3.4)
+os      :  Linux
+type    :  community dedicated
+map     : de_dust2
+players : 1 humans, 1 bots (16/0 max) (not hibernating)
+
+# userid name uniqueid connected ping loss state rate adr
+#  2 1 "Play "er"" STEAM_1:0:123 00:11 50 0 active 196608 5.6.7.8:27005
+#13 "Derek" BOT active 64
+#end
+`,
+			want: &ServerStatus{
+				Hostname:   "CSGO",
+				Version:    "1.38.0.0/13800",
+				Secure:     true,
+				Map:        "de_dust2",
+				Addr:       "0.0.0.0:27015",
+				PublicAddr: "1.2.3.4",
+				Players:    1,
+				Bots:       1,
+				MaxPlayers: 16,
+				Clients: []*StatusClient{
+					{UserID: 2, Name: `Play "er"`, UniqueID: "STEAM_1:0:123", Connected: 11 * time.Second, Ping: 50, State: "active", Rate: 196608, Addr: "5.6.7.8:27005"},
+					{UserID: 13, Name: "Derek", UniqueID: "BOT", State: "active", Rate: 64, Bot: true},
+				},
+			},
+		},
+		{
+			name: "listen server",
+			out: `hostname: Garry's Mod
+version : 2023.06.28/24 9057 insecure
+udp/ip  : 192.168.1.2:27015
+map     : gm_construct at: 0 x, 0 y, 0 z
+players : 1 (20 max)
+
+# userid name                uniqueid            connected ping loss state  adr
+#      2 "Host"              STEAM_0:1:123       00:25        0    0 active loopback
+`,
+			want: &ServerStatus{
+				Hostname:   "Garry's Mod",
+				Version:    "2023.06.28/24",
+				Map:        "gm_construct",
+				Addr:       "192.168.1.2:27015",
+				Players:    1,
+				MaxPlayers: 20,
+				Clients: []*StatusClient{
+					{UserID: 2, Name: "Host", UniqueID: "STEAM_0:1:123", Connected: 25 * time.Second, State: "active", Addr: "loopback"},
+				},
+			},
+		},
+		{
+			name: "hlds",
+			out: `hostname:  [CS 1.6] Public
+version :  48/1.1.2.7/Stdio 8684 secure  (10)
+tcp/ip  :  1.2.3.4:27015
+map     :  de_dust2 at: 0 x, 0 y, 0 z
+players :  3 active (32 max)
+
+#      name userid uniqueid frag time ping loss adr
+# 1 "Player" 12 STEAM_0:0:1234   5 12:34   45    0 5.6.7.8:27005
+# 2 "[BOT] Ernie" 13 BOT   0 05:00    0    0
+# 3 "Host" 14 STEAM_0:0:42   0 1:00:12    0    0 loopback
+3 users
+`,
+			want: &ServerStatus{
+				Hostname:   "[CS 1.6] Public",
+				Version:    "48/1.1.2.7/Stdio",
+				Secure:     true,
+				Map:        "de_dust2",
+				Addr:       "1.2.3.4:27015",
+				Players:    3,
+				MaxPlayers: 32,
+				Clients: []*StatusClient{
+					{UserID: 12, Name: "Player", UniqueID: "STEAM_0:0:1234", Connected: 12*time.Minute + 34*time.Second, Ping: 45, Addr: "5.6.7.8:27005"},
+					{UserID: 13, Name: "[BOT] Ernie", UniqueID: "BOT", Connected: 5 * time.Minute, Bot: true},
+					{UserID: 14, Name: "Host", UniqueID: "STEAM_0:0:42", Connected: time.Hour + 12*time.Second, Addr: "loopback"},
+				},
+			},
+		},
+		{
+			name: "cs2",
+			out: `Server:  Running [0.0.0.0:27015]
+Client:  Disconnected
+@ Current  :  game
+source   : console
+hostname : CS2 box
+spawn    : 1
+version  : 1.40.0.0/14000 9842 secure  public
+steamid  : [A:1:123]
+udp/ip   : 0.0.0.0:27015 (public ip: 1.2.3.4)
+os/type  : Linux dedicated
+players  : 2 humans, 1 bots (0 max) (not hibernating) (unreserved)
+loaded spawngroup(  1)  : SV:  [1: de_dust2 | main lump | mapload]
+---------players--------
+  id     time ping loss      state   rate adr name
+65535 [NoChan]    0    0 challenging      0unknown ''
+    2      00:23   30    0     active 786432 5.6.7.8:27005 'Player 'One''
+    3      05:00   12    1     active 786432 127.0.0.1:27005 '[host]'
+    4        BOT    0    0     active      0 'Rezan'
+#end
+`,
+			want: &ServerStatus{
+				Hostname:   "CS2 box",
+				Version:    "1.40.0.0/14000",
+				Secure:     true,
+				Map:        "de_dust2",
+				Addr:       "0.0.0.0:27015",
+				PublicAddr: "1.2.3.4",
+				Players:    2,
+				Bots:       1,
+				Clients: []*StatusClient{
+					{UserID: 2, Name: "Player 'One'", Connected: 23 * time.Second, Ping: 30, State: "active", Rate: 786432, Addr: "5.6.7.8:27005"},
+					{UserID: 3, Name: "[host]", Connected: 5 * time.Minute, Ping: 12, Loss: 1, State: "active", Rate: 786432, Addr: "127.0.0.1:27005"},
+					{UserID: 4, Name: "Rezan", State: "active", Bot: true},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatus(tt.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clients, want := got.Clients, *tt.want
+			got.Clients, want.Clients = nil, nil
+			if !reflect.DeepEqual(*got, want) {
+				t.Fatalf("got %+v, want %+v", *got, want)
+			}
+			if len(clients) != len(tt.want.Clients) {
+				t.Fatalf("got %v clients, want %v", len(clients), len(tt.want.Clients))
+			}
+			for i, c := range clients {
+				if !reflect.DeepEqual(c, tt.want.Clients[i]) {
+					t.Errorf("client %v: got %+v, want %+v", i, *c, *tt.want.Clients[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatusNotStatus(t *testing.T) {
+	if _, err := ParseStatus("Unknown command \"status\"\n"); err != errBadData {
+		t.Fatalf("got error %v, want %v", err, errBadData)
+	}
+}
+
+func TestServerStatusNotStatus(t *testing.T) {
+	// The test server echoes commands, which is no status output.
+	rs, addr := startRCONServer(t)
+	defer rs.Close()
+	s, err := NewRCONClient(addr, &ConnectOptions{RCONPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, err = s.Status()
+	if !errors.Is(err, ErrMalformedPacket) {
+		t.Fatalf("got error %v, want %v", err, ErrMalformedPacket)
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Op != OpRCONExec || oe.Addr != addr {
+		t.Fatalf("got error %#v, want an *OpError of %v", err, OpRCONExec)
+	}
+}
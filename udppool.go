@@ -0,0 +1,107 @@
+package steam
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of sockets kept open for later queries.
+const maxIdleUDPSockets = 4
+
+// udpPool hands out connected UDP sockets to the server, so concurrent
+// queries each read their own responses.
+type udpPool struct {
+	// Packets dropped by the sockets, first for 64-bit alignment.
+	dropped uint64
+
+	dial    dialContextFn
+	addr    string
+	timeout time.Duration
+
+	// Set if the sockets are unconnected, to accept replies from other
+	// addresses.
+	accept func(net.Addr) bool
+
+	mu     sync.Mutex
+	idle   []*udpSocket
+	closed bool
+
+	// Split packet format, once a socket detected it.
+	format SplitPacketFormat
+}
+
+func newUDPPool(dial dialContextFn, addr string, accept func(net.Addr) bool, format SplitPacketFormat, timeout time.Duration) *udpPool {
+	return &udpPool{
+		dial:    dial,
+		addr:    addr,
+		accept:  accept,
+		timeout: timeout,
+		format:  format,
+	}
+}
+
+// get returns an idle socket, or opens a new one.
+func (p *udpPool) get(ctx context.Context) (*udpSocket, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errClosed
+	}
+	if n := len(p.idle); n > 0 {
+		s := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return s, nil
+	}
+	format := p.format
+	p.mu.Unlock()
+	var (
+		s   *udpSocket
+		err error
+	)
+	if p.accept != nil {
+		s, err = listenUDPSocket(p.addr, p.accept, format, p.timeout)
+	} else {
+		s, err = newUDPSocket(ctx, p.dial, p.addr, format, p.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.dropped = &p.dropped
+	return s, nil
+}
+
+// put hands back a socket once the query is over. Sockets of failed
+// queries are closed, as the late response could be read by the next
+// query.
+func (p *udpPool) put(s *udpSocket, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.format == SPFAuto {
+		p.format = s.format
+	}
+	if err != nil || p.closed || len(p.idle) >= maxIdleUDPSockets {
+		s.close()
+		return
+	}
+	p.idle = append(p.idle, s)
+}
+
+// close closes the idle sockets. Sockets in use are closed once handed
+// back.
+func (p *udpPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, s := range p.idle {
+		s.close()
+	}
+	p.idle = nil
+}
+
+func (p *udpPool) droppedPackets() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
@@ -1,58 +1,242 @@
 package steam
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 type udpSocket struct {
 	conn net.Conn
+
+	// Set instead of conn for unconnected sockets, which send to raddr and
+	// accept replies from the addresses accept allows.
+	pconn  net.PacketConn
+	raddr  net.Addr
+	accept func(net.Addr) bool
+
+	// Counts the packets dropped as they did not answer the request. May
+	// be nil.
+	dropped *uint64
+
+	// Split packet format of the server. Once detected it is kept for
+	// later responses.
+	format SplitPacketFormat
+
+	// Time to wait for a whole response.
+	timeout time.Duration
 }
 
-func newUDPSocket(dial DialFn, addr string) (*udpSocket, error) {
-	conn, err := dial("udp", addr)
+func newUDPSocket(ctx context.Context, dial dialContextFn, addr string, format SplitPacketFormat, timeout time.Duration) (*udpSocket, error) {
+	conn, err := dial(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpSocket{conn: conn, format: format, timeout: timeout}, nil
+}
+
+// listenUDPSocket opens an unconnected socket sending to addr.
+func listenUDPSocket(addr string, accept func(net.Addr) bool, format SplitPacketFormat, timeout time.Duration) (*udpSocket, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pconn, err := net.ListenPacket("udp", "")
 	if err != nil {
 		return nil, err
 	}
-	return &udpSocket{conn}, nil
+	return &udpSocket{
+		pconn:   pconn,
+		raddr:   raddr,
+		accept:  accept,
+		format:  format,
+		timeout: timeout,
+	}, nil
+}
+
+// newReplyFilter returns a function accepting the addresses of the server
+// and of replyAddrs. Entries of replyAddrs without a port accept any port.
+func newReplyFilter(addr string, replyAddrs []string) (func(net.Addr) bool, error) {
+	accepted := make(map[string]bool)
+	for _, a := range append([]string{addr}, replyAddrs...) {
+		if _, _, err := net.SplitHostPort(a); err != nil {
+			ip, err := net.ResolveIPAddr("ip", a)
+			if err != nil {
+				return nil, err
+			}
+			accepted[ip.IP.String()] = true
+			continue
+		}
+		ua, err := net.ResolveUDPAddr("udp", a)
+		if err != nil {
+			return nil, err
+		}
+		accepted[ua.String()] = true
+	}
+	return func(addr net.Addr) bool {
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok {
+			return accepted[addr.String()]
+		}
+		return accepted[ua.String()] || accepted[ua.IP.String()]
+	}, nil
 }
 
 func (s *udpSocket) close() {
+	if s.pconn != nil {
+		s.pconn.Close()
+		return
+	}
 	s.conn.Close()
 }
 
+func (s *udpSocket) remoteAddr() net.Addr {
+	if s.pconn != nil {
+		return s.raddr
+	}
+	return s.conn.RemoteAddr()
+}
+
+type readDeadliner interface {
+	deadliner
+	SetReadDeadline(t time.Time) error
+}
+
+func (s *udpSocket) deadliner() readDeadliner {
+	if s.pconn != nil {
+		return s.pconn
+	}
+	return s.conn
+}
+
 func (s *udpSocket) send(payload []byte) error {
-	n, err := s.conn.Write(payload)
+	var (
+		n   int
+		err error
+	)
+	if s.pconn != nil {
+		n, err = s.pconn.WriteTo(payload, s.raddr)
+	} else {
+		n, err = s.conn.Write(payload)
+	}
 	if err != nil {
 		return err
 	}
 	if n != len(payload) {
-		return fmt.Errorf("steam: could not send full udp request to %v", s.conn.RemoteAddr())
+		return fmt.Errorf("steam: could not send full udp request to %v", s.remoteAddr())
 	}
 	return nil
 }
 
-func (s *udpSocket) receivePacket() ([]byte, error) {
-	if err := s.conn.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
-		return nil, err
-	}
+// receivePacket reads the next packet and the address it came from.
+// Unconnected sockets drop the packets of other addresses.
+func (s *udpSocket) receivePacket() ([]byte, net.Addr, error) {
 	buf := make([]byte, 1500)
-	n, err := s.conn.Read(buf)
-	if err != nil {
-		return nil, err
+	if s.pconn == nil {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		return buf[:n], s.conn.RemoteAddr(), nil
+	}
+	for {
+		n, addr, err := s.pconn.ReadFrom(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if s.accept(addr) {
+			return buf[:n], addr, nil
+		}
+		s.drop(buf[:n], addr, errUnexpectedAddr)
 	}
-	return buf[:n], nil
 }
 
-func (s *udpSocket) receive() ([]byte, error) {
-	buf, err := s.receivePacket()
-	if err != nil {
-		return nil, err
+// receive reads the next response, reassembling it first if the server
+// split it over several packets. All fragments must arrive within the
+// timeout of the socket, and before ctx is done.
+//
+// If headers are given, responses starting with another header are
+// dropped, such as late replies to an earlier request which timed out.
+func (s *udpSocket) receive(ctx context.Context, headers ...byte) ([]byte, error) {
+	data, _, err := s.receiveFrom(ctx, s.timeout, headers...)
+	return data, err
+}
+
+func (s *udpSocket) receiveTimeout(ctx context.Context, timeout time.Duration, headers ...byte) ([]byte, error) {
+	data, _, err := s.receiveFrom(ctx, timeout, headers...)
+	return data, err
+}
+
+// receiveFrom is like receiveTimeout, but also returns the address the
+// response came from. For split responses, it is the one of the last
+// fragment.
+func (s *udpSocket) receiveFrom(ctx context.Context, timeout time.Duration, headers ...byte) ([]byte, net.Addr, error) {
+	conn := s.deadliner()
+	if err := conn.SetReadDeadline(contextDeadline(ctx, timeout)); err != nil {
+		return nil, nil, err
+	}
+	stop := watchContext(ctx, conn)
+	defer stop()
+	assembler := multiPacketAssembler{format: s.format}
+	for {
+		buf, addr, err := s.receivePacket()
+		if err != nil {
+			return nil, nil, contextError(ctx, err)
+		}
+		if len(buf) < 5 {
+			s.drop(buf, addr, errNotEnoughDataInResponse)
+			continue
+		}
+		switch int32(binary.LittleEndian.Uint32(buf)) {
+		case singlePacketHeader:
+			if !acceptHeader(buf[4], headers) {
+				s.drop(buf, addr, errBadData)
+				continue
+			}
+			return buf[4:], addr, nil
+		case multiPacketHeader:
+			data, err := assembler.add(buf)
+			if err != nil {
+				return nil, nil, &packetError{err, buf}
+			}
+			if data == nil {
+				continue
+			}
+			s.format = assembler.format
+			if len(data) < 5 || int32(binary.LittleEndian.Uint32(data)) != singlePacketHeader {
+				return nil, nil, &packetError{errBadData, data}
+			}
+			if !acceptHeader(data[4], headers) {
+				s.drop(data, addr, errBadData)
+				continue
+			}
+			return data[4:], addr, nil
+		default:
+			s.drop(buf, addr, errBadData)
+		}
 	}
-	if buf[0] == 0xFE {
-		return nil, errors.New("steam: cannot handle split packets")
+}
+
+func (s *udpSocket) drop(data []byte, addr net.Addr, err error) {
+	log.WithFields(logrus.Fields{
+		"addr": addr,
+		"size": len(data),
+		"err":  err,
+	}).Debug("steam: dropping unexpected udp packet")
+	if s.dropped != nil {
+		atomic.AddUint64(s.dropped, 1)
 	}
-	return buf[4:], nil
 }
+
+func acceptHeader(h byte, headers []byte) bool {
+	return len(headers) == 0 || bytes.IndexByte(headers, h) >= 0
+}
+
+var errUnexpectedAddr = errors.New("steam: reply from unexpected address")
@@ -1,6 +1,13 @@
 package steam
 
+import "io"
+
+// must panics with err, which the decoders recover as their error. Running
+// out of data is reported as errNotEnoughDataInResponse.
 func must(err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		panic(errNotEnoughDataInResponse)
+	}
 	if err != nil {
 		panic(err)
 	}
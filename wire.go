@@ -14,9 +14,14 @@ func (e parseError) Error() string {
 	return string(e)
 }
 
+func (e parseError) Is(target error) bool {
+	return target == ErrMalformedPacket
+}
+
 var errCouldNotReadData = parseError("steam: could not read data")
 var errNotEnoughDataInResponse = parseError("steam: not enough data in response")
 var errBadData = parseError("steam: bad data in response")
+var errBadChecksum = parseError("steam: checksum mismatch in response")
 
 func readByte(r io.Reader) byte {
 	buf := make([]byte, 1)
@@ -32,7 +37,7 @@ func readBytes(r io.Reader, n int) (buf []byte) {
 	return
 }
 
-func readShort(r io.Reader) (v int16) {
+func readUShort(r io.Reader) (v uint16) {
 	must(binary.Read(r, binary.LittleEndian, &v))
 	return
 }
@@ -52,23 +57,25 @@ func readLongLong(r io.Reader) (v int64) {
 	return
 }
 
+// readString reads a NUL terminated string. The NUL is consumed but not
+// part of the returned string.
 func readString(r io.Reader) string {
 	if buf, ok := r.(*bytes.Buffer); ok {
 		// See if we are being passed a bytes.Buffer.
 		// Fast path.
 		bytes, err := buf.ReadBytes(0)
 		must(err)
-		return string(bytes)
+		return string(bytes[:len(bytes)-1])
 	}
 	var buf bytes.Buffer
 	for {
 		b := make([]byte, 1)
 		_, err := io.ReadFull(r, b)
 		must(err)
-		buf.WriteByte(b[0])
 		if b[0] == 0 {
 			break
 		}
+		buf.WriteByte(b[0])
 	}
 	return buf.String()
 }
@@ -84,6 +91,8 @@ func toInt(v interface{}) int {
 		return int(v)
 	case int16:
 		return int(v)
+	case uint16:
+		return int(v)
 	case int32:
 		return int(v)
 	case int64:
@@ -113,10 +122,26 @@ func writeByte(buf *bytes.Buffer, v byte) {
 	buf.WriteByte(v)
 }
 
+func writeUShort(buf *bytes.Buffer, v uint16) {
+	must(binary.Write(buf, binary.LittleEndian, v))
+}
+
 func writeLong(buf *bytes.Buffer, v int32) {
 	must(binary.Write(buf, binary.LittleEndian, v))
 }
 
+func writeULong(buf *bytes.Buffer, v uint32) {
+	must(binary.Write(buf, binary.LittleEndian, v))
+}
+
+func writeLongLong(buf *bytes.Buffer, v int64) {
+	must(binary.Write(buf, binary.LittleEndian, v))
+}
+
+func writeFloat(buf *bytes.Buffer, v float32) {
+	writeULong(buf, math.Float32bits(v))
+}
+
 func writeNull(buf *bytes.Buffer) {
 	buf.WriteByte(0)
 }
@@ -0,0 +1,76 @@
+package steam
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadString(t *testing.T) {
+	data := []byte("de_dust2\x00cstrike\x00")
+	readers := map[string]func() io.Reader{
+		"buffer": func() io.Reader { return bytes.NewBuffer(data) },
+		"reader": func() io.Reader { return strings.NewReader(string(data)) },
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			r := newReader()
+			if s := readString(r); s != "de_dust2" {
+				t.Fatalf("got %q, want %q", s, "de_dust2")
+			}
+			if s := readString(r); s != "cstrike" {
+				t.Fatalf("got %q, want %q", s, "cstrike")
+			}
+		})
+	}
+}
+
+func TestReadStringUnterminated(t *testing.T) {
+	var err error
+	func() {
+		defer func() {
+			err, _ = recover().(error)
+		}()
+		readString(bytes.NewBufferString("de_dust2"))
+	}()
+	if err != errNotEnoughDataInResponse {
+		t.Fatalf("got %v, want %v", err, errNotEnoughDataInResponse)
+	}
+}
+
+func TestMalformedPacketErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errBadData, true},
+		{errNotEnoughDataInResponse, true},
+		{&packetError{errBadChecksum, nil}, true},
+		// Replies from other hosts are not malformed, only unexpected.
+		{errUnexpectedAddr, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, ErrMalformedPacket); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReadUShort(t *testing.T) {
+	// Ports, app IDs and rule counts go above 32767.
+	tests := []struct {
+		data []byte
+		want int
+	}{
+		{[]byte{0x87, 0x69}, 27015},
+		{[]byte{0x40, 0x9C}, 40000},
+		{[]byte{0xFF, 0xFF}, 65535},
+	}
+	for _, tt := range tests {
+		if got := toInt(readUShort(bytes.NewBuffer(tt.data))); got != tt.want {
+			t.Errorf("% x: got %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}